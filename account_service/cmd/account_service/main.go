@@ -6,6 +6,7 @@ import (
 	"accountservice/internal/database"
 	"accountservice/internal/logging"
 	"accountservice/internal/service"
+	"context"
 	"fmt"
 	"log/slog"
 	"os"
@@ -18,13 +19,41 @@ func main() {
 	logger := logging.MustNewLogger("main")
 	slog.SetDefault(logger)
 
-	transactionClient := service.MustNewTransactionClient(cfg).WithQueue("", false, false).WithConsumer("")
-	defer transactionClient.Close()
+	if len(os.Args) > 1 {
+		var err error
+		switch os.Args[1] {
+		case "seed":
+			err = seed(cfg)
+		case "migrate":
+			err = migrate(cfg, os.Args[2:])
+		default:
+			slog.Error("unknown command", slog.String("command", os.Args[1]))
+			os.Exit(2)
+		}
+		if err != nil {
+			slog.Error("command failed", slog.String("command", os.Args[1]), slog.Any("error", err))
+			os.Exit(1)
+		}
+		return
+	}
+
+	broker := service.MustNewBroker(cfg)
+	defer broker.Close()
 
 	db := database.MustNewPostgres(cfg, 3)
 	defer db.Close()
 
-	app := router.MustNewApp(transactionClient, db)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if cfg.Postgres.Migrate {
+		if _, err := database.MigrateUp(ctx, db); err != nil {
+			slog.Error("failed to migrate database", slog.Any("error", err))
+			os.Exit(1)
+		}
+	}
+
+	app := router.MustNewApp(ctx, cfg, broker, db)
 	defer app.Shutdown()
 	go func() {
 		slog.Info("started listening", slog.Int("port", cfg.Server.Port))
@@ -38,4 +67,6 @@ func main() {
 	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
 	_ = <-ch
 	slog.Info("shutting down the app")
+	// the background jobs and the open streams are stopped before the server waits for the connections
+	cancel()
 }
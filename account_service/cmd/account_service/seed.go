@@ -0,0 +1,48 @@
+package main
+
+import (
+	"accountservice/internal/config"
+	"accountservice/internal/database"
+	"accountservice/internal/model"
+	"accountservice/internal/repo"
+	"context"
+	"log/slog"
+)
+
+var demoAccounts = []model.AccountRequest{
+	{OwnerRef: "demo", Currency: "RUB"},
+}
+
+// seed fills an empty database with demo accounts, it is never run on a regular start.
+func seed(cfg *config.Config) error {
+	ctx := context.Background()
+
+	db := database.MustNewPostgres(cfg, 1)
+	defer db.Close()
+
+	if cfg.Postgres.Migrate {
+		if _, err := database.MigrateUp(ctx, db); err != nil {
+			return err
+		}
+	}
+
+	accountRepo := repo.NewAccountPostgresRepo(db)
+
+	accounts, err := accountRepo.FindAll(ctx)
+	if err != nil {
+		return err
+	}
+	if len(accounts) > 0 {
+		slog.Info("database already has accounts, skipping seed")
+		return nil
+	}
+
+	for _, in := range demoAccounts {
+		account, err := accountRepo.InsertOne(ctx, in)
+		if err != nil {
+			return err
+		}
+		slog.Info("created demo account", slog.Uint64("id", uint64(account.Id)), slog.String("ownerRef", account.OwnerRef))
+	}
+	return nil
+}
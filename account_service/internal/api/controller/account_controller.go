@@ -4,12 +4,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log/slog"
 	"net/http"
 	"strings"
 
 	"accountservice/internal/errs"
 	"accountservice/internal/model"
+	"accountservice/internal/money"
 	"accountservice/internal/repo"
 	"accountservice/internal/service"
 
@@ -17,168 +17,276 @@ import (
 	"github.com/jackc/pgx/v5"
 )
 
+const maxOwnerRefLength = 255
+
 type accountController struct {
-	transactionClient *service.TransactionClient
-	accountRepo       repo.AccountRepo
-	transactionRepo   repo.TransactionRepo
+	rates           service.RateProvider
+	uow             repo.UnitOfWork
+	accountRepo     repo.AccountRepo
+	transactionRepo repo.TransactionRepo
 }
 
-func NewAccountController(client *service.TransactionClient, ar repo.AccountRepo, tr repo.TransactionRepo) accountController {
+func NewAccountController(rates service.RateProvider, uow repo.UnitOfWork, ar repo.AccountRepo, tr repo.TransactionRepo) accountController {
 	return accountController{
-		transactionClient: client,
-		accountRepo:       ar,
-		transactionRepo:   tr,
+		rates:           rates,
+		uow:             uow,
+		accountRepo:     ar,
+		transactionRepo: tr,
 	}
 }
 
-func (ac accountController) syncBalances(convertedAmount float64, transactionId uint, in model.TransactionRequest, op model.Operation) {
-	var (
-		ctx           context.Context = context.Background()
-		frozenChange  float64         = -1 * convertedAmount
-		balanceChange float64         = 0
-		status        model.Status
-		err           error
-	)
+// create stores the transaction with its outbox message and freezes the amount as one unit of work.
+func (ac accountController) create(c context.Context, in model.TransactionRequest, op model.Operation, fx model.FX) (model.Transaction, error) {
+	var transaction model.Transaction
+	err := ac.uow.Do(c, func(c context.Context) error {
+		var err error
+		if transaction, err = ac.transactionRepo.InsertOne(c, in, op, fx); err != nil {
+			return err
+		}
+		_, err = ac.accountRepo.Post(c, service.HoldEntry(transaction))
+		return err
+	})
+	return transaction, err
+}
 
-	slog.Debug("processing transaction")
-	status, err = ac.transactionClient.ProcessTransaction(ctx, transactionId)
-	if err != nil || status == model.Error {
-		slog.Error("failed to process transaction", slog.Any("error", err))
-	} else if err == nil && status == model.Success {
-		slog.Debug("processing successfuly completed")
+// createError maps the failures of create, a hold that would overdraw the wallet is the client's fault.
+func createError(op model.Operation, err error) error {
+	// the balance is checked before create, but a concurrent withdraw can still take it
+	if errors.Is(err, errs.ErrNegativeBalance) {
+		return model.ErrorResponse{
+			Code: http.StatusConflict,
+			Msg:  "can't withdraw more than active balance",
+			Err:  err,
+		}
+	}
+	return model.ErrorResponse{
+		Code: http.StatusInternalServerError,
+		Msg:  fmt.Sprintf("failed to create %s transaction", strings.ToLower(op.String())),
+		Err:  err,
 	}
+}
 
-	switch op {
-	case model.Invoice:
-		if status == model.Success {
-			balanceChange += convertedAmount
-		}
-	case model.Withdraw:
-		if status != model.Success {
-			balanceChange += convertedAmount
+func (ac accountController) Invoice(c *fiber.Ctx) error {
+	var in model.TransactionRequest
+	if err := c.BodyParser(&in); err != nil {
+		return bodyError("transactionRequest", err)
+	}
+
+	if in.Destination != nil {
+		if err := validateDestination(&in); err != nil {
+			return err
 		}
 	}
 
-	// TODO: нужно ли дополнительно обрабатывать ошибку при отмене транзакции и сбросе frozen?
-	if err := ac.transactionRepo.UpdateOne(ctx, transactionId, status); err != nil {
-		slog.Error("failed to update transaction status")
-		return
+	account, err := ac.findAccount(c, in.AccountId)
+	if err != nil {
+		return err
+	}
+
+	in.Currency = strings.ToUpper(in.Currency)
+	if err := validateAmount(in.Amount, in.Currency); err != nil {
+		return err
+	}
+	fx, err := service.Exchange(c.Context(), ac.rates, in.Currency, account.Currency, in.Amount)
+	if err != nil {
+		return currencyError(in.Currency, err)
 	}
 
-	if err := ac.accountRepo.UpdateOne(ctx, in.AccountId, balanceChange, frozenChange); err != nil {
-		slog.Error("failed to update account")
-		return
+	// the transaction is published to the processor by the outbox relay after commit
+	transaction, err := ac.create(c.Context(), in, model.Invoice, fx)
+	if err != nil {
+		return createError(model.Invoice, err)
 	}
+
+	c.Location(fmt.Sprintf("/api/transactions/%d", transaction.Id))
+	return c.Status(http.StatusCreated).JSON(transaction)
 }
 
-func (ac accountController) Invoice(c *fiber.Ctx) error {
+func (ac accountController) Withdraw(c *fiber.Ctx) error {
 	var in model.TransactionRequest
 	if err := c.BodyParser(&in); err != nil {
+		return bodyError("transactionRequest", err)
+	}
+
+	if in.Destination == nil {
 		return model.ErrorResponse{
-			Code: http.StatusUnprocessableEntity,
-			Msg:  "failed to parse transactionRequest body",
-			Err:  err,
+			Code:    http.StatusBadRequest,
+			Msg:     "invalid destination",
+			Details: []model.FieldError{{Field: "destination", Reason: "is required"}},
 		}
 	}
+	if err := validateDestination(&in); err != nil {
+		return err
+	}
+
+	account, err := ac.findAccount(c, in.AccountId)
+	if err != nil {
+		return err
+	}
 
 	in.Currency = strings.ToUpper(in.Currency)
-	convertedAmount, err := service.Convert(in.Currency, in.Amount)
+	if err := validateAmount(in.Amount, in.Currency); err != nil {
+		return err
+	}
+	fx, err := service.Exchange(c.Context(), ac.rates, in.Currency, account.Currency, in.Amount)
 	if err != nil {
-		var msg = "failed to convert currency"
-		if errors.Is(err, errs.ErrUnsupportedCurrency) {
-			msg = fmt.Sprintf("%s is not supported now", in.Currency)
-		}
 		return model.ErrorResponse{
 			Code: http.StatusBadRequest,
-			Msg:  msg,
+			Msg:  fmt.Sprintf("%s currency is not supported now", in.Currency),
 			Err:  err,
 		}
 	}
 
-	if err := ac.accountRepo.UpdateOne(c.Context(), in.AccountId, 0, convertedAmount); err != nil {
+	if account.Wallet(in.Currency).Balance.Cmp(in.Amount) < 0 {
 		return model.ErrorResponse{
 			Code: http.StatusBadRequest,
-			Msg:  "failed to update account",
-			Err:  err,
+			Msg:  "can't withdraw more than active balance",
 		}
 	}
 
-	transactionId, err := ac.transactionRepo.InsertOne(c.Context(), in, model.Invoice)
+	// the transaction is published to the processor by the outbox relay after commit
+	transaction, err := ac.create(c.Context(), in, model.Withdraw, fx)
 	if err != nil {
-		return model.ErrorResponse{
-			Code: http.StatusInternalServerError,
-			Msg:  "failed to create invoice transaction",
-			Err:  err,
-		}
+		return createError(model.Withdraw, err)
 	}
 
-	go ac.syncBalances(convertedAmount, transactionId, in, model.Invoice)
-
-	return c.SendStatus(http.StatusCreated)
+	c.Location(fmt.Sprintf("/api/transactions/%d", transaction.Id))
+	return c.Status(http.StatusCreated).JSON(transaction)
 }
 
-func (ac accountController) Withdraw(c *fiber.Ctx) error {
-	var in model.TransactionRequest
+func (ac accountController) Create(c *fiber.Ctx) error {
+	var in model.AccountRequest
 	if err := c.BodyParser(&in); err != nil {
 		return model.ErrorResponse{
 			Code: http.StatusUnprocessableEntity,
-			Msg:  "failed to parse transactionRequest body",
+			Msg:  "failed to parse accountRequest body",
+			Err:  err,
+		}
+	}
+
+	in.OwnerRef = strings.TrimSpace(in.OwnerRef)
+	if in.OwnerRef == "" || len(in.OwnerRef) > maxOwnerRefLength {
+		return model.ErrorResponse{
+			Code: http.StatusBadRequest,
+			Msg:  fmt.Sprintf("ownerRef must be from 1 to %d characters long", maxOwnerRefLength),
+		}
+	}
+
+	in.Currency = strings.ToUpper(in.Currency)
+	if in.Currency == "" {
+		in.Currency = service.BaseCurrency
+	}
+	if err := service.CheckCurrency(c.Context(), ac.rates, in.Currency); err != nil {
+		if errors.Is(err, errs.ErrUnsupportedCurrency) {
+			return model.ErrorResponse{
+				Code: http.StatusBadRequest,
+				Msg:  fmt.Sprintf("%s currency is not supported now", in.Currency),
+				Err:  err,
+			}
+		}
+		return model.ErrorResponse{
+			Code: http.StatusServiceUnavailable,
+			Msg:  "failed to check currency",
 			Err:  err,
 		}
 	}
 
-	convertedAmount, err := service.Convert(in.Currency, in.Amount)
+	account, err := ac.accountRepo.InsertOne(c.Context(), in)
 	if err != nil {
+		return model.ErrorResponse{
+			Code: http.StatusInternalServerError,
+			Msg:  "failed to create account",
+			Err:  err,
+		}
+	}
+
+	c.Location(fmt.Sprintf("/api/accounts/%d", account.Id))
+	return c.Status(http.StatusCreated).JSON(account)
+}
+
+func (ac accountController) FindOne(c *fiber.Ctx) error {
+	accountId, err := c.ParamsInt("id")
+	if err != nil || accountId <= 0 {
 		return model.ErrorResponse{
 			Code: http.StatusBadRequest,
-			Msg:  fmt.Sprintf("%s currency is not supported now", in.Currency),
+			Msg:  "invalid account id",
 			Err:  err,
 		}
 	}
 
-	account, err := ac.accountRepo.FindOne(c.Context(), in.AccountId)
+	account, err := ac.findAccount(c, uint(accountId))
+	if err != nil {
+		return err
+	}
+	return c.Status(http.StatusOK).JSON(account)
+}
+
+func (ac accountController) findAccount(c *fiber.Ctx, accountId uint) (model.Account, error) {
+	account, err := ac.accountRepo.FindOne(c.Context(), accountId)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return model.ErrorResponse{
+			return account, model.ErrorResponse{
 				Code: http.StatusNotFound,
 				Msg:  "account record not found",
 				Err:  err,
 			}
 		}
-		return model.ErrorResponse{
+		return account, model.ErrorResponse{
 			Code: http.StatusInternalServerError,
 			Msg:  "failed to get account",
 			Err:  err,
 		}
 	}
+	return account, nil
+}
 
-	if account.Balance < convertedAmount {
+// bodyError reports an invalid amount as a bad request and other parse failures as unprocessable.
+func bodyError(name string, err error) error {
+	if errors.Is(err, money.ErrInvalidAmount) {
 		return model.ErrorResponse{
 			Code: http.StatusBadRequest,
-			Msg:  "can't withdraw more than active balance",
+			Msg:  "invalid amount",
+			Err:  err,
 		}
 	}
+	return model.ErrorResponse{
+		Code: http.StatusUnprocessableEntity,
+		Msg:  fmt.Sprintf("failed to parse %s body", name),
+		Err:  err,
+	}
+}
 
-	if err := ac.accountRepo.UpdateOne(c.Context(), in.AccountId, -1*convertedAmount, convertedAmount); err != nil {
+// validateAmount checks that the amount is positive and has no fractions of the currency minor unit.
+func validateAmount(amount money.Amount, currency string) error {
+	if amount.Sign() <= 0 {
 		return model.ErrorResponse{
 			Code: http.StatusBadRequest,
-			Msg:  "failed to update account",
-			Err:  err,
+			Msg:  "amount must be positive",
 		}
 	}
-
-	transactionId, err := ac.transactionRepo.InsertOne(c.Context(), in, model.Withdraw)
-	if err != nil {
+	if !amount.FitsCurrency(currency) {
 		return model.ErrorResponse{
-			Code: http.StatusInternalServerError,
-			Msg:  "failed to create withdraw transaction",
-			Err:  err,
+			Code: http.StatusBadRequest,
+			Msg:  fmt.Sprintf("%s amount can't have more than %d decimal places", currency, money.MinorUnits(currency)),
 		}
 	}
+	return nil
+}
 
-	go ac.syncBalances(convertedAmount, transactionId, in, model.Withdraw)
-
-	return c.SendStatus(http.StatusCreated)
+// validateDestination normalizes the request destination in place.
+// The full card number is dropped here, the transaction stores and the processor receives the masked one.
+func validateDestination(in *model.TransactionRequest) error {
+	destination, fieldErrs := service.ValidateDestination(*in.Destination)
+	if len(fieldErrs) > 0 {
+		return model.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Msg:     "invalid destination",
+			Details: fieldErrs,
+		}
+	}
+	destination = destination.Masked()
+	in.Destination = &destination
+	return nil
 }
 
 func (ac accountController) List(c *fiber.Ctx) error {
@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"accountservice/internal/errs"
+	"accountservice/internal/model"
+	"accountservice/internal/repo"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
+)
+
+type deadLetterController struct {
+	deadLetterRepo repo.DeadLetterRepo
+}
+
+func NewDeadLetterController(dr repo.DeadLetterRepo) deadLetterController {
+	return deadLetterController{
+		deadLetterRepo: dr,
+	}
+}
+
+// List returns the dead letters waiting for a redrive, ?all=true includes the redriven ones.
+func (dc deadLetterController) List(c *fiber.Ctx) error {
+	deadLetters, err := dc.deadLetterRepo.FindMany(c.Context(), c.QueryBool("all"))
+	if err != nil {
+		return model.ErrorResponse{
+			Code: http.StatusInternalServerError,
+			Msg:  "failed to get dead letters",
+			Err:  err,
+		}
+	}
+	return c.Status(http.StatusOK).JSON(deadLetters)
+}
+
+// Redrive sends the dead-lettered transaction to processing again.
+func (dc deadLetterController) Redrive(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return model.ErrorResponse{
+			Code: http.StatusBadRequest,
+			Msg:  "invalid dead letter id",
+			Err:  err,
+		}
+	}
+
+	deadLetter, err := dc.deadLetterRepo.Redrive(c.Context(), uint(id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return model.ErrorResponse{
+				Code: http.StatusNotFound,
+				Msg:  "dead letter not found or already redriven",
+				Err:  err,
+			}
+		}
+		if errors.Is(err, errs.ErrFinalStatus) {
+			return model.ErrorResponse{
+				Code: http.StatusConflict,
+				Msg:  "transaction of the dead letter is already settled",
+				Err:  err,
+			}
+		}
+		return model.ErrorResponse{
+			Code: http.StatusInternalServerError,
+			Msg:  "failed to redrive dead letter",
+			Err:  err,
+		}
+	}
+	return c.Status(http.StatusOK).JSON(deadLetter)
+}
@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"net/http"
+	"strings"
+
+	"accountservice/internal/model"
+	"accountservice/internal/repo"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type rateController struct {
+	rateRepo repo.RateRepo
+}
+
+func NewRateController(rr repo.RateRepo) rateController {
+	return rateController{
+		rateRepo: rr,
+	}
+}
+
+// Latest returns the rates currently used for conversions.
+func (rc rateController) Latest(c *fiber.Ctx) error {
+	rates, err := rc.rateRepo.FindLatest(c.Context())
+	if err != nil {
+		return model.ErrorResponse{
+			Code: http.StatusInternalServerError,
+			Msg:  "failed to get rates",
+			Err:  err,
+		}
+	}
+	return c.Status(http.StatusOK).JSON(rates)
+}
+
+// History returns the rates of the currency applied in the time range.
+func (rc rateController) History(c *fiber.Ctx) error {
+	currency := strings.ToUpper(c.Query("currency"))
+	if currency == "" {
+		return model.ErrorResponse{
+			Code: http.StatusBadRequest,
+			Msg:  "currency is required",
+		}
+	}
+
+	from, err := parseTimeQuery(c, "from")
+	if err != nil {
+		return model.ErrorResponse{
+			Code: http.StatusBadRequest,
+			Msg:  err.Error(),
+			Err:  err,
+		}
+	}
+	to, err := parseTimeQuery(c, "to")
+	if err != nil {
+		return model.ErrorResponse{
+			Code: http.StatusBadRequest,
+			Msg:  err.Error(),
+			Err:  err,
+		}
+	}
+
+	rates, err := rc.rateRepo.FindHistory(c.Context(), currency, from, to)
+	if err != nil {
+		return model.ErrorResponse{
+			Code: http.StatusInternalServerError,
+			Msg:  "failed to get rates history",
+			Err:  err,
+		}
+	}
+	return c.Status(http.StatusOK).JSON(rates)
+}
@@ -0,0 +1,145 @@
+package controller
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"accountservice/internal/model"
+	"accountservice/internal/repo"
+	"accountservice/internal/service"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
+)
+
+// streamPingInterval keeps idle streams open behind proxies.
+const streamPingInterval = 15 * time.Second
+
+type streamController struct {
+	accountRepo repo.AccountRepo
+	hub         *service.StreamHub
+}
+
+func NewStreamController(ar repo.AccountRepo, hub *service.StreamHub) streamController {
+	return streamController{
+		accountRepo: ar,
+		hub:         hub,
+	}
+}
+
+// Stream sends the account state and then its balance and transaction events as Server-Sent Events.
+// The first event is "snapshot" with the account, the next ones are named by the event type.
+// A reconnecting client sends the Last-Event-ID header, then the events after it are replayed instead of the snapshot.
+func (sc streamController) Stream(c *fiber.Ctx) error {
+	accountId, err := c.ParamsInt("id")
+	if err != nil || accountId <= 0 {
+		return model.ErrorResponse{
+			Code: http.StatusBadRequest,
+			Msg:  "invalid account id",
+			Err:  err,
+		}
+	}
+	var lastEventId uint64
+	if header := c.Get("Last-Event-ID"); header != "" {
+		lastEventId, err = strconv.ParseUint(header, 10, 32)
+		if err != nil {
+			return model.ErrorResponse{
+				Code: http.StatusBadRequest,
+				Msg:  "invalid Last-Event-ID",
+				Err:  err,
+			}
+		}
+	}
+
+	// subscribe before the snapshot, so no change is missed between them
+	events, unsubscribe := sc.hub.Subscribe(uint(accountId))
+	account, err := sc.accountRepo.FindOne(c.Context(), uint(accountId))
+	if err != nil {
+		unsubscribe()
+		if errors.Is(err, pgx.ErrNoRows) {
+			return model.ErrorResponse{
+				Code: http.StatusNotFound,
+				Msg:  "account record not found",
+				Err:  err,
+			}
+		}
+		return model.ErrorResponse{
+			Code: http.StatusInternalServerError,
+			Msg:  "failed to get account",
+			Err:  err,
+		}
+	}
+	snapshot, err := json.Marshal(account)
+	if err != nil {
+		unsubscribe()
+		return err
+	}
+
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer unsubscribe()
+
+		// the replayed events may come from the subscription too
+		replayed := make(map[uint]struct{})
+		if lastEventId > 0 {
+			err := sc.hub.Replay(context.Background(), uint(accountId), uint(lastEventId), func(event model.Event) error {
+				replayed[event.Id] = struct{}{}
+				return writeEvent(w, event)
+			})
+			if err != nil {
+				slog.Error("failed to replay events", slog.Int("accountId", accountId), slog.Any("error", err))
+				return
+			}
+		} else {
+			fmt.Fprintf(w, "event: snapshot\ndata: %s\n\n", snapshot)
+		}
+		if err := w.Flush(); err != nil {
+			return
+		}
+
+		ping := time.NewTicker(streamPingInterval)
+		defer ping.Stop()
+		for {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				if _, ok := replayed[event.Id]; ok {
+					continue
+				}
+				if err := writeEvent(w, event); err != nil {
+					return
+				}
+			case <-ping.C:
+				fmt.Fprint(w, ": ping\n\n")
+			}
+			// the write fails when the client is gone
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	})
+	return nil
+}
+
+// writeEvent writes the event with its id, so the client can resume the stream after it.
+func writeEvent(w *bufio.Writer, event model.Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Id, event.Type, body)
+	return err
+}
@@ -0,0 +1,189 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"accountservice/internal/model"
+	"accountservice/internal/money"
+	"accountservice/internal/repo"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 500
+)
+
+type transactionController struct {
+	accountRepo     repo.AccountRepo
+	transactionRepo repo.TransactionRepo
+}
+
+func NewTransactionController(ar repo.AccountRepo, tr repo.TransactionRepo) transactionController {
+	return transactionController{
+		accountRepo:     ar,
+		transactionRepo: tr,
+	}
+}
+
+func (tc transactionController) ListByAccount(c *fiber.Ctx) error {
+	accountId, err := c.ParamsInt("id")
+	if err != nil || accountId <= 0 {
+		return model.ErrorResponse{
+			Code: http.StatusBadRequest,
+			Msg:  "invalid account id",
+			Err:  err,
+		}
+	}
+
+	filter, err := parseTransactionFilter(c)
+	if err != nil {
+		return model.ErrorResponse{
+			Code: http.StatusBadRequest,
+			Msg:  err.Error(),
+			Err:  err,
+		}
+	}
+	filter.AccountId = uint(accountId)
+
+	if _, err := tc.accountRepo.FindOne(c.Context(), filter.AccountId); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return model.ErrorResponse{
+				Code: http.StatusNotFound,
+				Msg:  "account record not found",
+				Err:  err,
+			}
+		}
+		return model.ErrorResponse{
+			Code: http.StatusInternalServerError,
+			Msg:  "failed to get account",
+			Err:  err,
+		}
+	}
+
+	page, err := tc.transactionRepo.FindPage(c.Context(), filter)
+	if err != nil {
+		return model.ErrorResponse{
+			Code: http.StatusInternalServerError,
+			Msg:  "failed to get transactions",
+			Err:  err,
+		}
+	}
+	return c.Status(http.StatusOK).JSON(page)
+}
+
+func (tc transactionController) FindOne(c *fiber.Ctx) error {
+	transactionId, err := c.ParamsInt("id")
+	if err != nil || transactionId <= 0 {
+		return model.ErrorResponse{
+			Code: http.StatusBadRequest,
+			Msg:  "invalid transaction id",
+			Err:  err,
+		}
+	}
+
+	transaction, err := tc.transactionRepo.FindOne(c.Context(), uint(transactionId))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return model.ErrorResponse{
+				Code: http.StatusNotFound,
+				Msg:  "transaction record not found",
+				Err:  err,
+			}
+		}
+		return model.ErrorResponse{
+			Code: http.StatusInternalServerError,
+			Msg:  "failed to get transaction",
+			Err:  err,
+		}
+	}
+	return c.Status(http.StatusOK).JSON(transaction)
+}
+
+func parseTransactionFilter(c *fiber.Ctx) (model.TransactionFilter, error) {
+	var (
+		filter = model.TransactionFilter{Order: model.Desc, Limit: defaultPageLimit}
+		err    error
+	)
+
+	if v := c.Query("operation"); v != "" {
+		if filter.Operation, err = model.ParseOperation(v); err != nil {
+			return filter, err
+		}
+	}
+	if v := c.Query("status"); v != "" {
+		if filter.Status, err = model.ParseStatus(v); err != nil {
+			return filter, err
+		}
+	}
+	filter.Currency = strings.ToUpper(c.Query("currency"))
+
+	if filter.MinAmount, err = parseAmountQuery(c, "minAmount"); err != nil {
+		return filter, err
+	}
+	if filter.MaxAmount, err = parseAmountQuery(c, "maxAmount"); err != nil {
+		return filter, err
+	}
+	if filter.CreatedFrom, err = parseTimeQuery(c, "from"); err != nil {
+		return filter, err
+	}
+	if filter.CreatedTo, err = parseTimeQuery(c, "to"); err != nil {
+		return filter, err
+	}
+
+	switch order := model.SortOrder(strings.ToLower(c.Query("order"))); order {
+	case "":
+	case model.Asc, model.Desc:
+		filter.Order = order
+	default:
+		return filter, fmt.Errorf("order must be %q or %q", model.Asc, model.Desc)
+	}
+
+	if v := c.Query("limit"); v != "" {
+		if filter.Limit, err = strconv.Atoi(v); err != nil || filter.Limit <= 0 || filter.Limit > maxPageLimit {
+			return filter, fmt.Errorf("limit must be between 1 and %d", maxPageLimit)
+		}
+	}
+
+	if v := c.Query("cursor"); v != "" {
+		cursor, err := model.ParseTransactionCursor(v)
+		if err != nil {
+			return filter, err
+		}
+		filter.Cursor = &cursor
+	}
+
+	return filter, nil
+}
+
+func parseAmountQuery(c *fiber.Ctx, key string) (*money.Amount, error) {
+	v := c.Query(key)
+	if v == "" {
+		return nil, nil
+	}
+	amount, err := money.Parse(v)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be a number", key)
+	}
+	return &amount, nil
+}
+
+// parseTimeQuery accepts RFC3339 timestamps, created_at is stored in UTC.
+func parseTimeQuery(c *fiber.Ctx, key string) (time.Time, error) {
+	v := c.Query(key)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return t, fmt.Errorf("%s must be an RFC3339 timestamp", key)
+	}
+	return t.UTC(), nil
+}
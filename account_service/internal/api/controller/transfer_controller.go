@@ -0,0 +1,145 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"accountservice/internal/errs"
+	"accountservice/internal/model"
+	"accountservice/internal/repo"
+	"accountservice/internal/service"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
+)
+
+type transferController struct {
+	rates           service.RateProvider
+	uow             repo.UnitOfWork
+	accountRepo     repo.AccountRepo
+	transactionRepo repo.TransactionRepo
+}
+
+func NewTransferController(rates service.RateProvider, uow repo.UnitOfWork, ar repo.AccountRepo, tr repo.TransactionRepo) transferController {
+	return transferController{
+		rates:           rates,
+		uow:             uow,
+		accountRepo:     ar,
+		transactionRepo: tr,
+	}
+}
+
+// Transfer moves funds between two accounts in one database transaction without the processor.
+// If the accounts have different base currencies, the receiver gets the amount converted to its base currency.
+func (tc transferController) Transfer(c *fiber.Ctx) error {
+	var in model.TransferRequest
+	if err := c.BodyParser(&in); err != nil {
+		return bodyError("transferRequest", err)
+	}
+
+	in.Currency = strings.ToUpper(in.Currency)
+	if err := validateAmount(in.Amount, in.Currency); err != nil {
+		return err
+	}
+	if in.FromAccountId == in.ToAccountId {
+		return model.ErrorResponse{
+			Code: http.StatusBadRequest,
+			Msg:  "can't transfer to the same account",
+		}
+	}
+
+	from, err := tc.findAccount(c, in.FromAccountId)
+	if err != nil {
+		return err
+	}
+	to, err := tc.findAccount(c, in.ToAccountId)
+	if err != nil {
+		return err
+	}
+
+	fx, err := service.Exchange(c.Context(), tc.rates, in.Currency, from.Currency, in.Amount)
+	if err != nil {
+		return currencyError(in.Currency, err)
+	}
+
+	creditCurrency, creditAmount := in.Currency, in.Amount
+	if from.Currency != to.Currency {
+		creditCurrency = to.Currency
+		if creditAmount, err = service.Convert(c.Context(), tc.rates, in.Currency, to.Currency, in.Amount); err != nil {
+			return currencyError(in.Currency, err)
+		}
+	}
+
+	var transaction model.Transaction
+	err = tc.uow.Do(c.Context(), func(c context.Context) error {
+		var err error
+		if transaction, err = tc.transactionRepo.InsertTransfer(c, in, fx); err != nil {
+			return err
+		}
+		_, err = tc.accountRepo.Post(c, service.TransferEntry(transaction, creditCurrency, creditAmount))
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, errs.ErrInsufficientFunds) {
+			return model.ErrorResponse{
+				Code: http.StatusBadRequest,
+				Msg:  "can't transfer more than active balance",
+				Err:  err,
+			}
+		}
+		if errors.Is(err, errs.ErrNegativeBalance) {
+			return model.ErrorResponse{
+				Code: http.StatusConflict,
+				Msg:  "can't transfer more than active balance",
+				Err:  err,
+			}
+		}
+		return model.ErrorResponse{
+			Code: http.StatusInternalServerError,
+			Msg:  "failed to create transfer transaction",
+			Err:  err,
+		}
+	}
+
+	c.Location(fmt.Sprintf("/api/transactions/%d", transaction.Id))
+	return c.Status(http.StatusCreated).JSON(transaction)
+}
+
+func (tc transferController) findAccount(c *fiber.Ctx, accountId uint) (model.Account, error) {
+	account, err := tc.accountRepo.FindOne(c.Context(), accountId)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return account, model.ErrorResponse{
+				Code: http.StatusNotFound,
+				Msg:  fmt.Sprintf("account %d not found", accountId),
+				Err:  err,
+			}
+		}
+		return account, model.ErrorResponse{
+			Code: http.StatusInternalServerError,
+			Msg:  "failed to get account",
+			Err:  err,
+		}
+	}
+	return account, nil
+}
+
+func currencyError(currency string, err error) model.ErrorResponse {
+	var (
+		code = http.StatusBadRequest
+		msg  = "failed to convert currency"
+	)
+	if errors.Is(err, errs.ErrUnsupportedCurrency) {
+		msg = fmt.Sprintf("%s is not supported now", currency)
+	} else if errors.Is(err, errs.ErrCurrencyServiceUnavailable) {
+		code = http.StatusServiceUnavailable
+	}
+	return model.ErrorResponse{
+		Code: code,
+		Msg:  msg,
+		Err:  err,
+	}
+}
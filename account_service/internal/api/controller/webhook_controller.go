@@ -0,0 +1,258 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"accountservice/internal/errs"
+	"accountservice/internal/model"
+	"accountservice/internal/repo"
+	"accountservice/internal/service"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
+)
+
+type webhookController struct {
+	accountRepo repo.AccountRepo
+	webhookRepo repo.WebhookRepo
+	// allowPrivate lets webhooks point to loopback, private and link-local addresses
+	allowPrivate bool
+}
+
+func NewWebhookController(ar repo.AccountRepo, wr repo.WebhookRepo, allowPrivate bool) webhookController {
+	return webhookController{
+		accountRepo:  ar,
+		webhookRepo:  wr,
+		allowPrivate: allowPrivate,
+	}
+}
+
+// account parses the :id param and checks that the account exists.
+func (wc webhookController) account(c *fiber.Ctx) (uint, error) {
+	accountId, err := c.ParamsInt("id")
+	if err != nil || accountId <= 0 {
+		return 0, model.ErrorResponse{
+			Code: http.StatusBadRequest,
+			Msg:  "invalid account id",
+			Err:  err,
+		}
+	}
+
+	if _, err := wc.accountRepo.FindOne(c.Context(), uint(accountId)); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, model.ErrorResponse{
+				Code: http.StatusNotFound,
+				Msg:  "account record not found",
+				Err:  err,
+			}
+		}
+		return 0, model.ErrorResponse{
+			Code: http.StatusInternalServerError,
+			Msg:  "failed to get account",
+			Err:  err,
+		}
+	}
+	return uint(accountId), nil
+}
+
+// Register adds a webhook to the account, the signing secret is returned only here.
+func (wc webhookController) Register(c *fiber.Ctx) error {
+	accountId, err := wc.account(c)
+	if err != nil {
+		return err
+	}
+
+	var in model.WebhookRequest
+	if err := c.BodyParser(&in); err != nil {
+		return model.ErrorResponse{
+			Code: http.StatusUnprocessableEntity,
+			Msg:  "failed to parse webhookRequest body",
+			Err:  err,
+		}
+	}
+	u, err := url.ParseRequestURI(in.Url)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return model.ErrorResponse{
+			Code:    http.StatusBadRequest,
+			Msg:     "invalid url",
+			Details: []model.FieldError{{Field: "url", Reason: "must be an absolute http or https url"}},
+			Err:     err,
+		}
+	}
+	if !wc.allowPrivate {
+		if err := service.CheckWebhookHost(c.Context(), u.Hostname()); err != nil {
+			reason := "host can't be resolved"
+			if errors.Is(err, errs.ErrPrivateAddress) {
+				reason = "must not point to a loopback, private or link-local address"
+			}
+			return model.ErrorResponse{
+				Code:    http.StatusBadRequest,
+				Msg:     "invalid url",
+				Details: []model.FieldError{{Field: "url", Reason: reason}},
+				Err:     err,
+			}
+		}
+	}
+
+	secret, err := service.NewWebhookSecret()
+	if err != nil {
+		return model.ErrorResponse{
+			Code: http.StatusInternalServerError,
+			Msg:  "failed to generate webhook secret",
+			Err:  err,
+		}
+	}
+	webhook, err := wc.webhookRepo.InsertOne(c.Context(), accountId, u.String(), secret)
+	if err != nil {
+		return model.ErrorResponse{
+			Code: http.StatusInternalServerError,
+			Msg:  "failed to register webhook",
+			Err:  err,
+		}
+	}
+	return c.Status(http.StatusCreated).JSON(webhook)
+}
+
+func (wc webhookController) List(c *fiber.Ctx) error {
+	accountId, err := wc.account(c)
+	if err != nil {
+		return err
+	}
+
+	webhooks, err := wc.webhookRepo.FindByAccount(c.Context(), accountId)
+	if err != nil {
+		return model.ErrorResponse{
+			Code: http.StatusInternalServerError,
+			Msg:  "failed to get webhooks",
+			Err:  err,
+		}
+	}
+	return c.Status(http.StatusOK).JSON(webhooks)
+}
+
+func (wc webhookController) Delete(c *fiber.Ctx) error {
+	accountId, err := wc.account(c)
+	if err != nil {
+		return err
+	}
+	webhookId, err := c.ParamsInt("webhookId")
+	if err != nil || webhookId <= 0 {
+		return model.ErrorResponse{
+			Code: http.StatusBadRequest,
+			Msg:  "invalid webhook id",
+			Err:  err,
+		}
+	}
+
+	if err := wc.webhookRepo.DeleteOne(c.Context(), accountId, uint(webhookId)); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return model.ErrorResponse{
+				Code: http.StatusNotFound,
+				Msg:  "webhook not found",
+				Err:  err,
+			}
+		}
+		return model.ErrorResponse{
+			Code: http.StatusInternalServerError,
+			Msg:  "failed to delete webhook",
+			Err:  err,
+		}
+	}
+	return c.SendStatus(http.StatusNoContent)
+}
+
+// Deliveries returns the deliveries of the account webhooks, ?status=failed lists the ones to redeliver.
+func (wc webhookController) Deliveries(c *fiber.Ctx) error {
+	accountId, err := wc.account(c)
+	if err != nil {
+		return err
+	}
+
+	status := model.DeliveryStatus(c.Query("status"))
+	switch status {
+	case "", model.DeliveryPending, model.DeliveryDelivered, model.DeliveryFailed:
+	default:
+		return model.ErrorResponse{
+			Code: http.StatusBadRequest,
+			Msg:  "invalid delivery status",
+		}
+	}
+
+	deliveries, err := wc.webhookRepo.FindDeliveries(c.Context(), accountId, status)
+	if err != nil {
+		return model.ErrorResponse{
+			Code: http.StatusInternalServerError,
+			Msg:  "failed to get webhook deliveries",
+			Err:  err,
+		}
+	}
+	return c.Status(http.StatusOK).JSON(deliveries)
+}
+
+// Delivery returns the delivery of the account webhooks with the log of its attempts.
+func (wc webhookController) Delivery(c *fiber.Ctx) error {
+	accountId, err := wc.account(c)
+	if err != nil {
+		return err
+	}
+	deliveryId, err := c.ParamsInt("deliveryId")
+	if err != nil || deliveryId <= 0 {
+		return model.ErrorResponse{
+			Code: http.StatusBadRequest,
+			Msg:  "invalid delivery id",
+			Err:  err,
+		}
+	}
+
+	delivery, err := wc.webhookRepo.FindDelivery(c.Context(), accountId, uint(deliveryId))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return model.ErrorResponse{
+				Code: http.StatusNotFound,
+				Msg:  "webhook delivery not found",
+				Err:  err,
+			}
+		}
+		return model.ErrorResponse{
+			Code: http.StatusInternalServerError,
+			Msg:  "failed to get webhook delivery",
+			Err:  err,
+		}
+	}
+	return c.Status(http.StatusOK).JSON(delivery)
+}
+
+// Redeliver schedules a failed delivery of the account webhooks for an immediate attempt.
+func (wc webhookController) Redeliver(c *fiber.Ctx) error {
+	accountId, err := wc.account(c)
+	if err != nil {
+		return err
+	}
+	deliveryId, err := c.ParamsInt("deliveryId")
+	if err != nil || deliveryId <= 0 {
+		return model.ErrorResponse{
+			Code: http.StatusBadRequest,
+			Msg:  "invalid delivery id",
+			Err:  err,
+		}
+	}
+
+	delivery, err := wc.webhookRepo.Redeliver(c.Context(), accountId, uint(deliveryId))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return model.ErrorResponse{
+				Code: http.StatusNotFound,
+				Msg:  "failed webhook delivery not found",
+				Err:  err,
+			}
+		}
+		return model.ErrorResponse{
+			Code: http.StatusInternalServerError,
+			Msg:  "failed to redeliver webhook",
+			Err:  err,
+		}
+	}
+	return c.Status(http.StatusOK).JSON(delivery)
+}
@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"accountservice/internal/errs"
+	"accountservice/internal/model"
+	"accountservice/internal/repo"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+)
+
+// Idempotency replays the stored response for requests repeated with the same Idempotency-Key header.
+// Requests without the header are passed through, server errors are not stored so the request can be retried.
+// A key left without a response for lease, for example by a crash, is reserved by the next request.
+func Idempotency(r repo.IdempotencyRepo, retention, lease time.Duration) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key := c.Get(IdempotencyKeyHeader)
+		if key == "" {
+			return c.Next()
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			return model.ErrorResponse{
+				Code: http.StatusBadRequest,
+				Msg:  "idempotency key is too long",
+			}
+		}
+
+		fingerprint := requestFingerprint(c)
+		record, reserved, err := r.Reserve(c.Context(), key, fingerprint, retention, lease)
+		if err != nil {
+			return model.ErrorResponse{
+				Code: http.StatusInternalServerError,
+				Msg:  "failed to reserve idempotency key",
+				Err:  err,
+			}
+		}
+
+		if !reserved {
+			if record.Fingerprint != fingerprint {
+				return model.ErrorResponse{
+					Code: http.StatusConflict,
+					Msg:  "idempotency key is already used for another request",
+					Err:  errs.ErrIdempotencyKeyReused,
+				}
+			}
+			if record.StatusCode == 0 {
+				return model.ErrorResponse{
+					Code: http.StatusConflict,
+					Msg:  "request with this idempotency key is still in progress",
+					Err:  errs.ErrIdempotencyKeyInProgress,
+				}
+			}
+
+			c.Set(IdempotentReplayedHeader, "true")
+			if record.ContentType != "" {
+				c.Set(fiber.HeaderContentType, record.ContentType)
+			}
+			if record.Location != "" {
+				c.Location(record.Location)
+			}
+			return c.Status(record.StatusCode).Send(record.Response)
+		}
+
+		if err := c.Next(); err != nil {
+			if err := c.App().Config().ErrorHandler(c, err); err != nil {
+				release(c, r, key)
+				return err
+			}
+		}
+
+		statusCode := c.Response().StatusCode()
+		if statusCode >= http.StatusInternalServerError {
+			release(c, r, key)
+			return nil
+		}
+
+		record = model.IdempotencyRecord{
+			Key:         key,
+			StatusCode:  statusCode,
+			ContentType: string(c.Response().Header.ContentType()),
+			Location:    string(c.Response().Header.Peek(fiber.HeaderLocation)),
+			Response:    append([]byte(nil), c.Response().Body()...),
+		}
+		if err := r.Complete(c.Context(), record); err != nil {
+			slog.Error("failed to store idempotent response", slog.String("key", key), slog.Any("error", err))
+		}
+		return nil
+	}
+}
+
+func release(c *fiber.Ctx, r repo.IdempotencyRepo, key string) {
+	if err := r.Release(c.Context(), key); err != nil {
+		slog.Error("failed to release idempotency key", slog.String("key", key), slog.Any("error", err))
+	}
+}
+
+func requestFingerprint(c *fiber.Ctx) string {
+	h := sha256.New()
+	h.Write([]byte(c.Method()))
+	h.Write([]byte{'\n'})
+	h.Write([]byte(c.Path()))
+	h.Write([]byte{'\n'})
+	h.Write(c.Body())
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -5,9 +5,11 @@ import (
 	"errors"
 	"log/slog"
 	"net/http"
+	"time"
 
 	"accountservice/internal/api/controller"
-	"accountservice/internal/errs"
+	"accountservice/internal/api/middleware"
+	"accountservice/internal/config"
 	"accountservice/internal/model"
 	"accountservice/internal/repo"
 	"accountservice/internal/service"
@@ -18,7 +20,7 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-func MustNewApp(transactionClient *service.TransactionClient, db *pgxpool.Pool) *fiber.App {
+func MustNewApp(ctx context.Context, cfg *config.Config, broker service.Broker, db *pgxpool.Pool) *fiber.App {
 	app := fiber.New(fiber.Config{
 		AppName: "Transaction System",
 		ErrorHandler: func(c *fiber.Ctx, e error) error {
@@ -33,7 +35,7 @@ func MustNewApp(transactionClient *service.TransactionClient, db *pgxpool.Pool)
 	})
 
 	SetupMiddlewares(app)
-	if err := SetupRoutes(app, transactionClient, db); err != nil {
+	if err := SetupRoutes(ctx, app, cfg, broker, db); err != nil {
 		panic(err)
 	}
 
@@ -45,38 +47,93 @@ func SetupMiddlewares(app *fiber.App) {
 	app.Use(recover.New())
 }
 
-func SetupRoutes(app *fiber.App, transactionClient *service.TransactionClient, db *pgxpool.Pool) error {
+// SetupRoutes also starts the background jobs: rates refresher, outbox and event relays, recovery of stuck transactions,
+// cleanup of expired idempotency keys, webhook deliveries, the account streams and the dead letter consumer.
+// They run until ctx is cancelled.
+func SetupRoutes(ctx context.Context, app *fiber.App, cfg *config.Config, broker service.Broker, db *pgxpool.Pool) error {
 	api := app.Group("/api")
 
-	err := make(map[string]error, 2)
-	accountRepo, e := repo.NewAccountPostgresRepo(db)
-	err["account"] = e
+	accountRepo := repo.NewAccountPostgresRepo(db)
+	transactionRepo := repo.NewTransactionPostgresRepo(db)
+	idempotencyRepo := repo.NewIdempotencyPostgresRepo(db)
+	rateRepo := repo.NewRatePostgresRepo(db)
+	deadLetterRepo := repo.NewDeadLetterPostgresRepo(db)
 
-	transactionRepo, e := repo.NewTransactionPostgresRepo(db)
-	err["transaction"] = e
-
-	success := true
-	for repoName, e := range err {
-		if e != nil {
-			slog.Error(e.Error(), slog.String("repoName", repoName))
-			success = false
-		}
-	}
-	if !success {
-		return errs.ErrRepoCreate
+	upstream, e := service.NewRateProvider(cfg)
+	if e != nil {
+		return e
 	}
+	refresher := service.NewRateRefresher(upstream, rateRepo, cfg.Rates.RefreshInterval)
+	go refresher.Run(ctx)
+	rateProvider := service.NewStoreProvider(rateRepo)
 
-	// Suppose we already have account record in db
-	_, e = accountRepo.InsertOne(context.Background())
+	uow := repo.NewUnitOfWork(db)
+	settler := service.NewSettler(broker, uow, accountRepo, transactionRepo)
+	outboxRepo := repo.NewOutboxPostgresRepo(db)
+	// every publish of a batch may wait for the confirmation
+	outboxLease := time.Duration(cfg.Outbox.BatchSize)*cfg.Rabbit.ConfirmTimeout + cfg.Outbox.Interval
+	relay := service.NewOutboxRelay(outboxRepo, transactionRepo, broker, settler.Await, cfg.Outbox.Interval, cfg.Outbox.BatchSize, outboxLease)
+	go relay.Run(ctx)
+	// events are relayed with the outbox settings
+	eventRepo := repo.NewEventPostgresRepo(db)
+	eventRelay := service.NewEventRelay(eventRepo, broker, cfg.Outbox.Interval, cfg.Outbox.BatchSize)
+	go eventRelay.Run(ctx)
+	webhookRepo := repo.NewWebhookPostgresRepo(db)
+	webhooks := service.NewWebhookDispatcher(webhookRepo, cfg.Webhooks.Timeout, cfg.Webhooks.Interval, cfg.Webhooks.BatchSize, cfg.Webhooks.MaxAttempts, cfg.Webhooks.BaseDelay, cfg.Webhooks.AllowPrivate)
+	go webhooks.Run(ctx)
+	hub := service.NewStreamHub(eventRepo)
+	go hub.Run(ctx)
+	cleanup := service.NewIdempotencyCleanup(idempotencyRepo, cfg.Idempotency.CleanupInterval, cfg.Idempotency.Retention, cfg.Idempotency.CleanupBatchSize)
+	go cleanup.Run(ctx)
+	recovery := service.NewRecovery(outboxRepo, cfg.Recovery.Interval, cfg.Recovery.Threshold)
+	go recovery.Run(ctx)
+	e = broker.ConsumeDeadLetters(func(deadLetter model.DeadLetter) error {
+		_, err := deadLetterRepo.InsertOne(ctx, deadLetter)
+		return err
+	})
 	if e != nil {
 		return e
 	}
 
-	accountController := controller.NewAccountController(transactionClient, accountRepo, transactionRepo)
+	idempotency := middleware.Idempotency(idempotencyRepo, cfg.Idempotency.Retention, cfg.Idempotency.Lease)
+
+	accountController := controller.NewAccountController(rateProvider, uow, accountRepo, transactionRepo)
 	accounts := api.Group("/accounts")
-	accounts.Post("/invoice", accountController.Invoice)
-	accounts.Post("/withdraw", accountController.Withdraw)
+	accounts.Post("/invoice", idempotency, accountController.Invoice)
+	accounts.Post("/withdraw", idempotency, accountController.Withdraw)
+	accounts.Post("/", accountController.Create)
 	accounts.Get("/list", accountController.List)
+	accounts.Get("/:id", accountController.FindOne)
+	streamController := controller.NewStreamController(accountRepo, hub)
+	accounts.Get("/:id/stream", streamController.Stream)
+
+	transactionController := controller.NewTransactionController(accountRepo, transactionRepo)
+	accounts.Get("/:id/transactions", transactionController.ListByAccount)
+
+	webhookController := controller.NewWebhookController(accountRepo, webhookRepo, cfg.Webhooks.AllowPrivate)
+	accounts.Post("/:id/webhooks", webhookController.Register)
+	accounts.Get("/:id/webhooks", webhookController.List)
+	accounts.Get("/:id/webhooks/deliveries", webhookController.Deliveries)
+	accounts.Get("/:id/webhooks/deliveries/:deliveryId", webhookController.Delivery)
+	accounts.Post("/:id/webhooks/deliveries/:deliveryId/redeliver", webhookController.Redeliver)
+	accounts.Delete("/:id/webhooks/:webhookId", webhookController.Delete)
+
+	transactions := api.Group("/transactions")
+	transactions.Get("/:id", transactionController.FindOne)
+
+	transferController := controller.NewTransferController(rateProvider, uow, accountRepo, transactionRepo)
+	transfers := api.Group("/transfers")
+	transfers.Post("/", idempotency, transferController.Transfer)
+
+	rateController := controller.NewRateController(rateRepo)
+	rates := api.Group("/rates")
+	rates.Get("/", rateController.Latest)
+	rates.Get("/history", rateController.History)
+
+	deadLetterController := controller.NewDeadLetterController(deadLetterRepo)
+	admin := api.Group("/admin")
+	admin.Get("/dead-letters", deadLetterController.List)
+	admin.Post("/dead-letters/:id/redrive", deadLetterController.Redrive)
 
 	return nil
 }
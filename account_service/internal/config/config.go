@@ -1,6 +1,8 @@
 package config
 
 import (
+	"time"
+
 	"github.com/ilyakaznacheev/cleanenv"
 )
 
@@ -11,24 +13,87 @@ type Config struct {
 		Host     string `env:"POSTGRES_HOST" env-default:"localhost"`
 		Db       string `env:"POSTGRES_DB" env-default:"db"`
 		Port     int    `env:"POSTGRES_PORT" env-default:"5432"`
+		// Migrate applies the pending migrations on start, otherwise they are run by the migrate command
+		Migrate bool `env:"POSTGRES_MIGRATE" env-default:"true"`
 	}
 	Rabbit struct {
 		User     string `env:"RABBIT_USER" env-default:"guest"`
 		Password string `env:"RABBIT_PASSWORD" env-default:"guest"`
 		Host     string `env:"RABBIT_HOST" env-default:"localhost"`
 		Port     int    `env:"RABBIT_PORT" env-default:"5672"`
+		// ReplyTimeout is how long a processor reply is awaited, unanswered transactions are recovered later
+		ReplyTimeout time.Duration `env:"RABBIT_REPLY_TIMEOUT" env-default:"1m"`
+		// ReconnectMaxBackoff caps the delay between reconnect attempts
+		ReconnectMaxBackoff time.Duration `env:"RABBIT_RECONNECT_MAX_BACKOFF" env-default:"30s"`
+		// ConfirmTimeout is how long a publisher confirm is awaited
+		ConfirmTimeout time.Duration `env:"RABBIT_CONFIRM_TIMEOUT" env-default:"5s"`
 	}
 	Server struct {
 		Port int `env:"SERVER_PORT" env-default:"9999"`
 	}
+	Idempotency struct {
+		Retention time.Duration `env:"IDEMPOTENCY_RETENTION" env-default:"24h"`
+		// Lease is how long a key without a response stays reserved, then the request is taken as abandoned
+		// and the key is reserved again. It has to be longer than the slowest request.
+		Lease time.Duration `env:"IDEMPOTENCY_LEASE" env-default:"1m"`
+		// Expired keys are deleted every CleanupInterval by at most CleanupBatchSize at once
+		CleanupInterval  time.Duration `env:"IDEMPOTENCY_CLEANUP_INTERVAL" env-default:"10m"`
+		CleanupBatchSize int           `env:"IDEMPOTENCY_CLEANUP_BATCH_SIZE" env-default:"1000"`
+	}
+	Outbox struct {
+		Interval  time.Duration `env:"OUTBOX_INTERVAL" env-default:"1s"`
+		BatchSize int           `env:"OUTBOX_BATCH_SIZE" env-default:"100"`
+	}
+	Rates struct {
+		// Provider is cbr, fixture or a comma separated failover list like "cbr,fixture"
+		Provider    string        `env:"RATES_PROVIDER" env-default:"cbr"`
+		CBRUrl      string        `env:"RATES_CBR_URL" env-default:"https://www.cbr-xml-daily.ru/daily_json.js"`
+		FixturePath string        `env:"RATES_FIXTURE_PATH" env-default:"fixtures/rates.json"`
+		Timeout     time.Duration `env:"RATES_TIMEOUT" env-default:"10s"`
+		// RefreshInterval is how often the rates are downloaded and saved to the history
+		RefreshInterval time.Duration `env:"RATES_REFRESH_INTERVAL" env-default:"1h"`
+	}
+	Processor struct {
+		// Name is rabbit or memory, the memory processor needs no broker
+		Name string `env:"PROCESSOR" env-default:"rabbit"`
+		// Outcome of the memory processor: success, error, timeout or dead
+		Outcome string        `env:"PROCESSOR_OUTCOME" env-default:"success"`
+		Latency time.Duration `env:"PROCESSOR_LATENCY" env-default:"1s"`
+	}
+	Events struct {
+		// Exchange is the topic exchange of the domain events
+		Exchange string `env:"EVENTS_EXCHANGE" env-default:"account_service.events"`
+	}
+	Webhooks struct {
+		Interval  time.Duration `env:"WEBHOOKS_INTERVAL" env-default:"1s"`
+		BatchSize int           `env:"WEBHOOKS_BATCH_SIZE" env-default:"50"`
+		Timeout   time.Duration `env:"WEBHOOKS_TIMEOUT" env-default:"10s"`
+		// MaxAttempts is the number of attempts before a delivery is failed,
+		// the delay after the first failed attempt is BaseDelay and doubles with every next one
+		MaxAttempts int           `env:"WEBHOOKS_MAX_ATTEMPTS" env-default:"8"`
+		BaseDelay   time.Duration `env:"WEBHOOKS_BASE_DELAY" env-default:"10s"`
+		// AllowPrivate lets webhooks point to loopback, private and link-local addresses, it is meant for local runs
+		AllowPrivate bool `env:"WEBHOOKS_ALLOW_PRIVATE" env-default:"false"`
+	}
+	Recovery struct {
+		Interval  time.Duration `env:"RECOVERY_INTERVAL" env-default:"1m"`
+		Threshold time.Duration `env:"RECOVERY_THRESHOLD" env-default:"5m"`
+	}
 }
 
 func MustNewConfig(path string) *Config {
 	cfg := &Config{}
-	errs := make([]error, 3)
+	errs := make([]error, 10)
 	errs[0] = cleanenv.ReadConfig(path, &cfg.Postgres)
 	errs[1] = cleanenv.ReadConfig(path, &cfg.Rabbit)
 	errs[2] = cleanenv.ReadConfig(path, &cfg.Server)
+	errs[3] = cleanenv.ReadConfig(path, &cfg.Idempotency)
+	errs[4] = cleanenv.ReadConfig(path, &cfg.Outbox)
+	errs[5] = cleanenv.ReadConfig(path, &cfg.Recovery)
+	errs[6] = cleanenv.ReadConfig(path, &cfg.Rates)
+	errs[7] = cleanenv.ReadConfig(path, &cfg.Processor)
+	errs[8] = cleanenv.ReadConfig(path, &cfg.Events)
+	errs[9] = cleanenv.ReadConfig(path, &cfg.Webhooks)
 	for _, err := range errs {
 		if err != nil {
 			panic(err)
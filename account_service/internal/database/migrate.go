@@ -0,0 +1,250 @@
+package database
+
+import (
+	"accountservice/internal/errs"
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// MigrationsTable keeps the versions of the applied migrations.
+const MigrationsTable = "schema_migrations"
+
+// migrationLock is the advisory lock key, it keeps concurrent instances from migrating at once.
+const migrationLock int64 = 0x6d69677261746500
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Migration is a pair of <version>_<name>.up.sql and <version>_<name>.down.sql files.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Migrations returns the embedded migrations ordered by version.
+func Migrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		name, direction, ok := strings.Cut(strings.TrimSuffix(entry.Name(), ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("invalid migration file name %s", entry.Name())
+		}
+		prefix, name, _ := strings.Cut(name, "_")
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %s: %w", entry.Name(), err)
+		}
+		body, err := fs.ReadFile(migrationFiles, "migrations/"+entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d has no up file", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// MigrateUp applies the pending migrations in order, each one in its own transaction.
+func MigrateUp(ctx context.Context, db *pgxpool.Pool) (int, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return 0, err
+	}
+
+	applied := 0
+	err = withMigrationLock(ctx, db, func(conn *pgxpool.Conn) error {
+		versions, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			if _, ok := versions[m.Version]; ok {
+				continue
+			}
+			if err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+				if _, err := tx.Exec(ctx, m.Up); err != nil {
+					return err
+				}
+				_, err := tx.Exec(ctx, fmt.Sprintf(`
+					insert into %s(version, name)
+					values ($1, $2)
+				`, MigrationsTable), m.Version, m.Name)
+				return err
+			}); err != nil {
+				return fmt.Errorf("migration %d_%s: %w", m.Version, m.Name, err)
+			}
+			slog.Info("applied migration", slog.Int("version", m.Version), slog.String("name", m.Name))
+			applied++
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// MigrateDown reverts up to steps latest applied migrations.
+func MigrateDown(ctx context.Context, db *pgxpool.Pool, steps int) (int, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return 0, err
+	}
+	byVersion := make(map[int]Migration, len(migrations))
+	for _, m := range migrations {
+		byVersion[m.Version] = m
+	}
+
+	reverted := 0
+	err = withMigrationLock(ctx, db, func(conn *pgxpool.Conn) error {
+		versions, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		applied := make([]int, 0, len(versions))
+		for version := range versions {
+			applied = append(applied, version)
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(applied)))
+
+		for _, version := range applied[:min(steps, len(applied))] {
+			m, ok := byVersion[version]
+			if !ok {
+				return fmt.Errorf("migration %d: %w", version, errs.ErrUnknownMigration)
+			}
+			if err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+				if _, err := tx.Exec(ctx, m.Down); err != nil {
+					return err
+				}
+				_, err := tx.Exec(ctx, fmt.Sprintf(`
+					delete from %s
+					where version = $1
+				`, MigrationsTable), m.Version)
+				return err
+			}); err != nil {
+				return fmt.Errorf("migration %d_%s: %w", m.Version, m.Name, err)
+			}
+			slog.Info("reverted migration", slog.Int("version", m.Version), slog.String("name", m.Name))
+			reverted++
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// MigrationsStatus returns the embedded migrations with the time they were applied at, if they were.
+func MigrationsStatus(ctx context.Context, db *pgxpool.Pool) ([]MigrationStatus, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []MigrationStatus
+	err = withMigrationLock(ctx, db, func(conn *pgxpool.Conn) error {
+		versions, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			status := MigrationStatus{Migration: m}
+			if appliedAt, ok := versions[m.Version]; ok {
+				status.AppliedAt = &appliedAt
+			}
+			statuses = append(statuses, status)
+		}
+		return nil
+	})
+	return statuses, err
+}
+
+// withMigrationLock runs fn on a single connection holding the session advisory lock.
+func withMigrationLock(ctx context.Context, db *pgxpool.Pool, fn func(conn *pgxpool.Conn) error) error {
+	conn, err := db.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "select pg_advisory_lock($1)", migrationLock); err != nil {
+		return err
+	}
+	defer func() {
+		// the lock is released with the session anyway, so the error is only logged
+		if _, err := conn.Exec(context.Background(), "select pg_advisory_unlock($1)", migrationLock); err != nil {
+			slog.Error("failed to release migration lock", slog.Any("error", err))
+		}
+	}()
+
+	if _, err := conn.Exec(ctx, fmt.Sprintf(`
+		create table if not exists %s(
+			version int primary key,
+			name text not null,
+			applied_at timestamp not null default current_timestamp
+		)
+	`, MigrationsTable)); err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+func appliedVersions(ctx context.Context, conn *pgxpool.Conn) (map[int]time.Time, error) {
+	rows, err := conn.Query(ctx, fmt.Sprintf(`
+		select version, applied_at from %s
+	`, MigrationsTable))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := make(map[int]time.Time)
+	for rows.Next() {
+		var (
+			version   int
+			appliedAt time.Time
+		)
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		versions[version] = appliedAt
+	}
+	return versions, rows.Err()
+}
@@ -0,0 +1,13 @@
+drop table if exists idempotency_keys;
+drop table if exists rates;
+drop table if exists webhook_attempts;
+drop table if exists webhook_deliveries;
+drop table if exists webhooks;
+drop table if exists dead_letters;
+drop table if exists outbox;
+drop table if exists transactions;
+drop table if exists events;
+drop table if exists postings;
+drop table if exists journal_entries;
+drop table if exists wallets;
+drop table if exists accounts;
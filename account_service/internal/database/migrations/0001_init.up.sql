@@ -0,0 +1,213 @@
+-- The schema the repositories used to create on start. The statements are idempotent,
+-- so databases created before the migrations are adopted as is.
+create table if not exists accounts(
+	id serial primary key,
+	owner_ref text not null default '',
+	currency text not null default 'RUB',
+	created_at timestamp default current_timestamp,
+	updated_at timestamp default current_timestamp
+);
+alter table accounts add column if not exists owner_ref text not null default '';
+alter table accounts add column if not exists currency text not null default 'RUB';
+create table if not exists wallets(
+	id serial primary key,
+	fk_account_id int not null references accounts(id),
+	currency text not null,
+	balance numeric not null default 0,
+	frozen numeric not null default 0,
+	created_at timestamp default current_timestamp,
+	updated_at timestamp default current_timestamp,
+	unique (fk_account_id, currency)
+);
+create table if not exists journal_entries(
+	id serial primary key,
+	fk_transaction_id int,
+	kind smallint not null,
+	created_at timestamp default current_timestamp
+);
+create table if not exists postings(
+	id serial primary key,
+	fk_journal_entry_id int not null references journal_entries(id),
+	fk_account_id int references accounts(id),
+	bucket smallint not null,
+	currency text not null,
+	amount numeric not null
+);
+create index if not exists postings_fk_account_id_idx on postings(fk_account_id);
+-- a transaction is held and settled at most once
+create unique index if not exists journal_entries_transaction_kind_idx on journal_entries(fk_transaction_id, kind);
+
+-- balances used to be stored on the account in its currency
+do $$
+declare
+	moved boolean := false;
+	opening record;
+	entry_id int;
+begin
+	if exists (
+		select 1 from information_schema.columns
+		where table_name = 'accounts' and column_name = 'balance'
+	) then
+		insert into wallets(fk_account_id, currency, balance, frozen)
+		select id, currency, balance, frozen from accounts
+		on conflict do nothing;
+		alter table accounts drop column balance, drop column frozen;
+		moved := true;
+	end if;
+	if not exists (
+		select 1 from information_schema.columns
+		where table_name = 'postings' and column_name = 'currency'
+	) then
+		alter table postings add column currency text;
+		update postings p
+		set currency = coalesce((
+			select a.currency
+			from postings o
+			join accounts a on a.id = o.fk_account_id
+			where o.fk_journal_entry_id = p.fk_journal_entry_id
+			limit 1
+		), 'RUB');
+		alter table postings alter column currency set not null;
+	end if;
+	-- the moved balances are opened by an adjust entry (kind 3) against the adjustment bucket (4),
+	-- so the wallets reconcile with the postings of the available (1) and frozen (2) buckets
+	if moved then
+		for opening in
+			select w.fk_account_id, w.currency,
+				w.balance - coalesce(p.balance, 0) as balance,
+				w.frozen - coalesce(p.frozen, 0) as frozen
+			from wallets w
+			left join (
+				select fk_account_id, currency,
+					sum(amount) filter (where bucket = 1) as balance,
+					sum(amount) filter (where bucket = 2) as frozen
+				from postings
+				where fk_account_id is not null
+				group by fk_account_id, currency
+			) p on p.fk_account_id = w.fk_account_id and p.currency = w.currency
+			where w.balance <> coalesce(p.balance, 0) or w.frozen <> coalesce(p.frozen, 0)
+		loop
+			insert into journal_entries(kind) values (3) returning id into entry_id;
+			insert into postings(fk_journal_entry_id, fk_account_id, bucket, currency, amount)
+			select entry_id, nullif(b.owner, 0), b.bucket, opening.currency, b.amount
+			from (values
+				(opening.fk_account_id, 1, opening.balance),
+				(opening.fk_account_id, 2, opening.frozen),
+				(0, 4, -(opening.balance + opening.frozen))
+			) b(owner, bucket, amount)
+			where b.amount <> 0;
+		end loop;
+	end if;
+end $$;
+
+-- events of the balances and the transactions, written with the changes they describe
+create table if not exists events(
+	id serial primary key,
+	type text not null,
+	version int not null,
+	routing_key text not null,
+	data jsonb not null,
+	created_at timestamp not null default current_timestamp,
+	published_at timestamp
+);
+create index if not exists events_unpublished_idx on events(id) where published_at is null;
+
+create table if not exists transactions(
+	id serial primary key,
+	fk_account_id int references accounts(id),
+	fk_counterparty_account_id int references accounts(id),
+	amount numeric not null,
+	currency text not null,
+	converted_amount numeric not null default 0,
+	rate numeric,
+	rate_source text,
+	rate_valid_from timestamp,
+	operation smallint not null,
+	status smallint not null,
+	destination_type text,
+	destination text,
+	created_at timestamp default current_timestamp
+);
+alter table transactions add column if not exists converted_amount numeric not null default 0;
+alter table transactions add column if not exists rate numeric;
+alter table transactions add column if not exists rate_source text;
+alter table transactions add column if not exists rate_valid_from timestamp;
+alter table transactions add column if not exists fk_counterparty_account_id int references accounts(id);
+alter table transactions add column if not exists destination_type text;
+alter table transactions add column if not exists destination text;
+create index if not exists transactions_account_created_at_idx on transactions(fk_account_id, created_at, id);
+create index if not exists transactions_counterparty_created_at_idx on transactions(fk_counterparty_account_id, created_at, id);
+
+create table if not exists outbox(
+	id serial primary key,
+	fk_transaction_id int not null references transactions(id),
+	attempts int not null default 0,
+	last_error text,
+	created_at timestamp default current_timestamp,
+	sent_at timestamp
+);
+create index if not exists outbox_unsent_idx on outbox(id) where sent_at is null;
+
+create table if not exists dead_letters(
+	id serial primary key,
+	fk_transaction_id int references transactions(id) not null,
+	reason text not null,
+	attempts int not null default 0,
+	created_at timestamp not null default current_timestamp,
+	redriven_at timestamp
+);
+create index if not exists dead_letters_pending_idx on dead_letters(fk_transaction_id) where redriven_at is null;
+
+create table if not exists webhooks(
+	id serial primary key,
+	fk_account_id int not null references accounts(id),
+	url text not null,
+	secret text not null,
+	created_at timestamp not null default current_timestamp,
+	deleted_at timestamp
+);
+create table if not exists webhook_deliveries(
+	id serial primary key,
+	fk_webhook_id int not null references webhooks(id),
+	fk_transaction_id int not null references transactions(id),
+	payload jsonb not null,
+	status text not null default 'pending',
+	attempts int not null default 0,
+	next_attempt_at timestamp default current_timestamp,
+	last_error text,
+	created_at timestamp not null default current_timestamp,
+	delivered_at timestamp
+);
+create index if not exists webhook_deliveries_due_idx on webhook_deliveries(next_attempt_at) where status = 'pending';
+create table if not exists webhook_attempts(
+	id serial primary key,
+	fk_delivery_id int not null references webhook_deliveries(id),
+	attempt int not null,
+	response_code int,
+	error text,
+	delivered boolean not null,
+	next_attempt_at timestamp,
+	created_at timestamp not null default current_timestamp
+);
+
+create table if not exists rates(
+	id serial primary key,
+	currency text not null,
+	value numeric not null,
+	nominal numeric not null,
+	source text not null,
+	valid_from timestamp not null default current_timestamp
+);
+create index if not exists rates_currency_valid_from_idx on rates(currency, valid_from);
+
+create table if not exists idempotency_keys(
+	key text primary key,
+	fingerprint text not null,
+	status_code int not null default 0,
+	content_type text not null default '',
+	location text not null default '',
+	response bytea,
+	created_at timestamp default current_timestamp
+);
+alter table idempotency_keys add column if not exists location text not null default '';
+create index if not exists idempotency_keys_created_at_idx on idempotency_keys(created_at);
@@ -0,0 +1,5 @@
+drop trigger if exists transactions_final_status on transactions;
+drop function if exists transactions_final_status();
+alter table transactions drop constraint if exists transactions_status_known;
+alter table wallets drop constraint if exists wallets_frozen_nonnegative;
+alter table wallets drop constraint if exists wallets_balance_nonnegative;
@@ -0,0 +1,23 @@
+-- balances never go below zero, even if a check in the service is missed or raced
+-- the constraints are not valid yet, so the tables are not scanned under an exclusive lock,
+-- the existing rows are checked by 0004_validate_invariants
+alter table wallets add constraint wallets_balance_nonnegative check (balance >= 0) not valid;
+alter table wallets add constraint wallets_frozen_nonnegative check (frozen >= 0) not valid;
+
+-- statuses: 1 - Success, 2 - Error, 3 - Created
+alter table transactions add constraint transactions_status_known check (status in (1, 2, 3)) not valid;
+
+-- Success and Error are final, the violation is reported as the transactions_final_status check
+create or replace function transactions_final_status() returns trigger as $$
+begin
+	if old.status in (1, 2) and new.status <> old.status then
+		raise exception 'transaction % already has final status %', old.id, old.status
+			using errcode = 'check_violation', constraint = 'transactions_final_status';
+	end if;
+	return new;
+end
+$$ language plpgsql;
+
+create trigger transactions_final_status
+	before update of status on transactions
+	for each row execute function transactions_final_status();
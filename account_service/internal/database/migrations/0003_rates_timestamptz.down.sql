@@ -0,0 +1,2 @@
+alter table transactions alter column rate_valid_from type timestamp using rate_valid_from at time zone 'UTC';
+alter table rates alter column valid_from type timestamp using valid_from at time zone 'UTC';
@@ -0,0 +1,4 @@
+-- the rate validity is compared with client timestamps, so it keeps the time zone;
+-- existing values were written by current_timestamp of a UTC session
+alter table rates alter column valid_from type timestamptz using valid_from at time zone 'UTC';
+alter table transactions alter column rate_valid_from type timestamptz using rate_valid_from at time zone 'UTC';
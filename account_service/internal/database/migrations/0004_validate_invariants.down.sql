@@ -0,0 +1,7 @@
+-- the constraints stay, but the existing rows are not guaranteed to satisfy them anymore
+alter table transactions drop constraint if exists transactions_status_known;
+alter table transactions add constraint transactions_status_known check (status in (1, 2, 3)) not valid;
+alter table wallets drop constraint if exists wallets_frozen_nonnegative;
+alter table wallets add constraint wallets_frozen_nonnegative check (frozen >= 0) not valid;
+alter table wallets drop constraint if exists wallets_balance_nonnegative;
+alter table wallets add constraint wallets_balance_nonnegative check (balance >= 0) not valid;
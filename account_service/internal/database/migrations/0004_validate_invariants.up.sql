@@ -0,0 +1,28 @@
+-- the rows which violate the invariants of 0002_invariants are reported in the migration error,
+-- they are fixed by hand, e.g. with a ledger adjustment, before the migration is applied again
+do $$
+declare
+	violations int;
+	report text;
+begin
+	create temporary table invariant_violations on commit drop as
+		select format('wallet %s of account %s has balance %s and frozen %s', currency, fk_account_id, balance, frozen) as line
+		from wallets
+		where balance < 0 or frozen < 0
+		union all
+		select format('transaction %s has unknown status %s', id, status)
+		from transactions
+		where status not in (1, 2, 3);
+
+	select count(*) into violations from invariant_violations;
+	if violations > 0 then
+		select string_agg(line, '; ') into report from (select line from invariant_violations limit 50) shown;
+		raise exception '% rows violate the invariants: %', violations, report
+			using errcode = 'check_violation';
+	end if;
+end
+$$;
+
+alter table wallets validate constraint wallets_balance_nonnegative;
+alter table wallets validate constraint wallets_frozen_nonnegative;
+alter table transactions validate constraint transactions_status_known;
@@ -0,0 +1,2 @@
+-- the relay claims messages for a lease and publishes them outside of the claiming transaction
+alter table outbox add column locked_until timestamptz;
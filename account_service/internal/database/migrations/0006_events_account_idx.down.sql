@@ -0,0 +1,2 @@
+drop index if exists events_counterparty_id_idx;
+drop index if exists events_account_id_idx;
@@ -0,0 +1,3 @@
+-- the account streams look the events up by the account of either side, the expressions match FindByAccount
+create index if not exists events_account_id_idx on events(((data->>'accountId')::int), id);
+create index if not exists events_counterparty_id_idx on events(((data->>'counterpartyId')::int), id);
@@ -0,0 +1,2 @@
+alter table webhook_attempts alter column next_attempt_at type timestamp using next_attempt_at at time zone 'UTC';
+alter table webhook_deliveries alter column next_attempt_at type timestamp using next_attempt_at at time zone 'UTC';
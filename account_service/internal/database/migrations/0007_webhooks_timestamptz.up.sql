@@ -0,0 +1,4 @@
+-- the next attempt is computed in Go and compared with current_timestamp, so it keeps the time zone;
+-- existing values were written by current_timestamp of a UTC session
+alter table webhook_deliveries alter column next_attempt_at type timestamptz using next_attempt_at at time zone 'UTC';
+alter table webhook_attempts alter column next_attempt_at type timestamptz using next_attempt_at at time zone 'UTC';
@@ -0,0 +1 @@
+-- the masked card numbers can't be restored, they stay masked
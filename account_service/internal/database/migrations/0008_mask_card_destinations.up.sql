@@ -0,0 +1,6 @@
+-- full card numbers are not kept, only the first six and the last four digits like the API shows them
+update transactions
+set destination = left(destination, 6) || repeat('*', length(destination) - 10) || right(destination, 4)
+where destination_type = 'card'
+	and length(destination) > 10
+	and destination ~ '^[0-9]+$';
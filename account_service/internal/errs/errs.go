@@ -3,7 +3,22 @@ package errs
 import "errors"
 
 var (
-	ErrRepoCreate                 error = errors.New("failed to create repository instance")
+	ErrUnknownMigration           error = errors.New("applied migration is unknown to the service")
 	ErrUnsupportedCurrency        error = errors.New("unsupported currency")
 	ErrCurrencyServiceUnavailable error = errors.New("currency service unavailable")
+	ErrUnbalancedEntry            error = errors.New("journal entry postings do not sum up to zero")
+	ErrLedgerMismatch             error = errors.New("account balances do not match the ledger")
+	ErrIdempotencyKeyReused       error = errors.New("idempotency key is reused with a different request")
+	ErrIdempotencyKeyInProgress   error = errors.New("idempotency key is in progress")
+	ErrInvalidCursor              error = errors.New("invalid cursor")
+	ErrInsufficientFunds          error = errors.New("insufficient funds")
+	ErrNegativeBalance            error = errors.New("balance can't go below zero")
+	ErrNoUnitOfWork               error = errors.New("call must be made within a unit of work")
+	ErrFinalStatus                error = errors.New("final transaction status can't be changed")
+	ErrUnknownTransaction         error = errors.New("transaction does not exist")
+	ErrPrivateAddress             error = errors.New("address is loopback, private or link-local")
+	ErrProcessingTimeout          error = errors.New("transaction processing timed out")
+	ErrBrokerUnavailable          error = errors.New("message broker unavailable")
+	ErrUnroutable                 error = errors.New("message is not routed to any queue")
+	ErrPublishNotConfirmed        error = errors.New("message is not confirmed by the broker")
 )
@@ -2,15 +2,45 @@ package model
 
 import (
 	"time"
+
+	"accountservice/internal/money"
 )
 
-const AccountsTable = "accounts"
+const (
+	AccountsTable = "accounts"
+	WalletsTable  = "wallets"
+)
 
 type Account struct {
-	// валюта по умолчанию - рубль RUB
-	Id        uint      `json:"id"`
-	Balance   float64   `json:"balance"`
-	Frozen    float64   `json:"frozen"`
+	Id       uint   `json:"id"`
+	OwnerRef string `json:"ownerRef"`
+	// Currency is the base currency of the account, RUB by default
+	Currency  string    `json:"currency"`
+	Wallets   []Wallet  `json:"wallets"`
 	CreatedAt time.Time `json:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt"`
 }
+
+// Wallet returns the account wallet in the currency, missing wallets are empty.
+func (a Account) Wallet(currency string) Wallet {
+	for _, w := range a.Wallets {
+		if w.Currency == currency {
+			return w
+		}
+	}
+	return Wallet{Currency: currency}
+}
+
+// Wallet holds the active and frozen balance of an account in one currency.
+type Wallet struct {
+	Currency  string       `json:"currency"`
+	Balance   money.Amount `json:"balance"`
+	Frozen    money.Amount `json:"frozen"`
+	UpdatedAt time.Time    `json:"updatedAt"`
+}
+
+type AccountRequest struct {
+	// OwnerRef is the id of the account owner in the client system
+	OwnerRef string `json:"ownerRef"`
+	Currency string `json:"currency"`
+}
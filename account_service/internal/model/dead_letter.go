@@ -0,0 +1,19 @@
+package model
+
+import (
+	"time"
+)
+
+const DeadLettersTable = "dead_letters"
+
+// DeadLetter is a transaction the processor gave up on after the retries.
+type DeadLetter struct {
+	Id            uint   `json:"id"`
+	TransactionId uint   `json:"transactionId"`
+	Reason        string `json:"reason"`
+	// Attempts is the number of processing attempts made before the transaction was dead-lettered
+	Attempts  int       `json:"attempts"`
+	CreatedAt time.Time `json:"createdAt"`
+	// RedrivenAt is set when the transaction is sent to processing again
+	RedrivenAt *time.Time `json:"redrivenAt,omitempty"`
+}
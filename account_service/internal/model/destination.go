@@ -0,0 +1,37 @@
+package model
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+type DestinationType string
+
+const (
+	Card DestinationType = "card"
+	// UsdtTrc20 is a USDT wallet on TRON
+	UsdtTrc20 DestinationType = "usdt_trc20"
+	// UsdtErc20 is a USDT wallet on Ethereum
+	UsdtErc20 DestinationType = "usdt_erc20"
+)
+
+// Destination is the card or wallet the processor sends money to or takes money from.
+type Destination struct {
+	Type   DestinationType `json:"type"`
+	Number string          `json:"number"`
+}
+
+// Masked hides the card number, only the first six and the last four digits are kept.
+// Wallet addresses and masked numbers are returned as is.
+func (d Destination) Masked() Destination {
+	if d.Type == Card && len(d.Number) > 10 {
+		d.Number = d.Number[:6] + strings.Repeat("*", len(d.Number)-10) + d.Number[len(d.Number)-4:]
+	}
+	return d
+}
+
+// MarshalJSON masks card numbers.
+func (d Destination) MarshalJSON() ([]byte, error) {
+	type destination Destination
+	return json.Marshal(destination(d.Masked()))
+}
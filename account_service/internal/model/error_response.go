@@ -3,9 +3,16 @@ package model
 import "fmt"
 
 type ErrorResponse struct {
-	Code int    `json:"-"`
-	Msg  string `json:"msg"`
-	Err  error  `json:"-"`
+	Code    int          `json:"-"`
+	Msg     string       `json:"msg"`
+	Details []FieldError `json:"details,omitempty"`
+	Err     error        `json:"-"`
+}
+
+// FieldError describes why a request field is invalid.
+type FieldError struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
 }
 
 func (e ErrorResponse) Error() string {
@@ -0,0 +1,99 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"accountservice/internal/money"
+)
+
+const EventsTable = "events"
+
+// EventsChannel is the Postgres notification channel of the stored event ids.
+const EventsChannel = "events"
+
+// EventVersion is increased on incompatible changes of the event data.
+const EventVersion = 1
+
+type EventType string
+
+const (
+	TransactionCreated    EventType = "transaction.created"
+	TransactionSucceeded  EventType = "transaction.succeeded"
+	TransactionFailed     EventType = "transaction.failed"
+	AccountBalanceChanged EventType = "account.balance_changed"
+)
+
+// Event is a domain event published to the events exchange, Data depends on the Type.
+type Event struct {
+	Id      uint      `json:"id"`
+	Type    EventType `json:"type"`
+	Version int       `json:"version"`
+	// RoutingKey is the type followed by the operation and the currency
+	RoutingKey string          `json:"-"`
+	Data       json.RawMessage `json:"data"`
+	OccurredAt time.Time       `json:"occurredAt"`
+}
+
+// AccountIds returns the accounts the event belongs to.
+func (e Event) AccountIds() []uint {
+	var data struct {
+		AccountId      uint `json:"accountId"`
+		CounterpartyId uint `json:"counterpartyId"`
+	}
+	if err := json.Unmarshal(e.Data, &data); err != nil {
+		return nil
+	}
+	if data.CounterpartyId == 0 {
+		return []uint{data.AccountId}
+	}
+	return []uint{data.AccountId, data.CounterpartyId}
+}
+
+// BalanceChanged is the data of AccountBalanceChanged, the balances are the new ones.
+type BalanceChanged struct {
+	AccountId     uint         `json:"accountId"`
+	TransactionId uint         `json:"transactionId,omitempty"`
+	Currency      string       `json:"currency"`
+	Balance       money.Amount `json:"balance"`
+	Frozen        money.Amount `json:"frozen"`
+	BalanceChange money.Amount `json:"balanceChange"`
+	FrozenChange  money.Amount `json:"frozenChange"`
+}
+
+// NewTransactionEvent creates the event of the transaction status, the data is the transaction.
+func NewTransactionEvent(t Transaction) (Event, error) {
+	eventType := TransactionCreated
+	switch t.Status {
+	case Success:
+		eventType = TransactionSucceeded
+	case Error:
+		eventType = TransactionFailed
+	}
+
+	data, err := json.Marshal(t)
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{
+		Type:       eventType,
+		Version:    EventVersion,
+		RoutingKey: strings.ToLower(fmt.Sprintf("%s.%s.%s", eventType, t.Operation, t.Currency)),
+		Data:       data,
+	}, nil
+}
+
+func NewBalanceChangedEvent(b BalanceChanged) (Event, error) {
+	data, err := json.Marshal(b)
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{
+		Type:       AccountBalanceChanged,
+		Version:    EventVersion,
+		RoutingKey: strings.ToLower(fmt.Sprintf("%s.%s", AccountBalanceChanged, b.Currency)),
+		Data:       data,
+	}, nil
+}
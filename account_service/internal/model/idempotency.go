@@ -0,0 +1,18 @@
+package model
+
+import (
+	"time"
+)
+
+const IdempotencyKeysTable = "idempotency_keys"
+
+type IdempotencyRecord struct {
+	Key         string
+	Fingerprint string
+	// StatusCode is 0 while the original request is still in progress
+	StatusCode  int
+	ContentType string
+	Location    string
+	Response    []byte
+	CreatedAt   time.Time
+}
@@ -0,0 +1,78 @@
+package model
+
+import (
+	"time"
+
+	"accountservice/internal/money"
+)
+
+const (
+	JournalEntriesTable = "journal_entries"
+	PostingsTable       = "postings"
+)
+
+// Bucket is a ledger account. Available and Frozen belong to a customer account wallet,
+// the rest are system accounts and have no AccountId.
+type Bucket int8
+
+const (
+	_ Bucket = iota
+	Available
+	Frozen
+	// Settlement mirrors money held by the external processor
+	Settlement
+	// Adjustment is the counterpart of manual balance corrections
+	Adjustment
+	// Exchange balances the currency legs of converted transfers
+	Exchange
+)
+
+func (b Bucket) IsSystem() bool {
+	return b != Available && b != Frozen
+}
+
+type EntryKind int8
+
+const (
+	_ EntryKind = iota
+	// Hold freezes the transaction amount when the transaction is created
+	Hold
+	// Settle releases the frozen amount when the transaction gets a final status
+	Settle
+	// Adjust is a manual correction not bound to any transaction
+	Adjust
+	// Move transfers funds between account wallets
+	Move
+)
+
+type Posting struct {
+	AccountId uint         `json:"accountId,omitempty"`
+	Bucket    Bucket       `json:"bucket"`
+	Currency  string       `json:"currency"`
+	Amount    money.Amount `json:"amount"`
+}
+
+type JournalEntry struct {
+	Id            uint      `json:"id"`
+	TransactionId uint      `json:"transactionId,omitempty"`
+	Kind          EntryKind `json:"kind"`
+	Postings      []Posting `json:"postings"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// Balanced reports whether the postings of the entry sum up to zero in every currency.
+func (e JournalEntry) Balanced() bool {
+	if len(e.Postings) < 2 {
+		return false
+	}
+	sums := make(map[string]money.Amount)
+	for _, p := range e.Postings {
+		sums[p.Currency] = sums[p.Currency].Add(p.Amount)
+	}
+	for _, sum := range sums {
+		if !sum.IsZero() {
+			return false
+		}
+	}
+	return true
+}
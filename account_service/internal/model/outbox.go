@@ -0,0 +1,15 @@
+package model
+
+import (
+	"time"
+)
+
+const OutboxTable = "outbox"
+
+// OutboxMessage is a transaction waiting to be published to the processor.
+type OutboxMessage struct {
+	Id            uint
+	TransactionId uint
+	Attempts      int
+	CreatedAt     time.Time
+}
@@ -0,0 +1,21 @@
+package model
+
+import (
+	"time"
+
+	"accountservice/internal/money"
+)
+
+const RatesTable = "rates"
+
+// Rate is the price of Nominal units of Currency in the base currency.
+type Rate struct {
+	Currency string       `json:"currency"`
+	Value    money.Amount `json:"value"`
+	Nominal  money.Amount `json:"nominal"`
+	// Source is the name of the provider the rate was received from
+	Source    string    `json:"source"`
+	ValidFrom time.Time `json:"validFrom"`
+	// ValidTo is set in the history when the rate was replaced by a newer one
+	ValidTo *time.Time `json:"validTo,omitempty"`
+}
@@ -1,23 +1,99 @@
 package model
 
 import (
+	"encoding/base64"
+	"fmt"
 	"time"
+
+	"accountservice/internal/errs"
+	"accountservice/internal/money"
 )
 
 const TransactionsTable = "transactions"
 
 type Transaction struct {
-	Id        uint
-	AccountId uint
-	Amount    float64
-	Currency  string
-	Operation Operation
-	Status    Status
-	CreatedAt time.Time
+	Id        uint `json:"id"`
+	AccountId uint `json:"accountId"`
+	// CounterpartyId is the receiving account of a transfer
+	CounterpartyId uint         `json:"counterpartyId,omitempty"`
+	Amount         money.Amount `json:"amount"`
+	Currency       string       `json:"currency"`
+	FX
+	Operation   Operation    `json:"operation"`
+	Status      Status       `json:"status"`
+	Destination *Destination `json:"destination,omitempty"`
+	CreatedAt   time.Time    `json:"createdAt"`
+}
+
+// FX is the conversion of the transaction amount to the account base currency at the moment of creation.
+// ConvertedAmount is Amount * Rate rounded to the minor units of the base currency.
+type FX struct {
+	ConvertedAmount money.Amount `json:"convertedAmount"`
+	// Rate is the price of one unit of the transaction currency, transactions created
+	// before rates were recorded have no rate
+	Rate          *money.Amount `json:"rate,omitempty"`
+	RateSource    string        `json:"rateSource,omitempty"`
+	RateValidFrom *time.Time    `json:"rateValidFrom,omitempty"`
 }
 
 type TransactionRequest struct {
-	AccountId uint    `json:"accountId"`
-	Amount    float64 `json:"amount"`
-	Currency  string  `json:"currency"`
+	AccountId uint         `json:"accountId"`
+	Amount    money.Amount `json:"amount"`
+	Currency  string       `json:"currency"`
+	// Destination is required for withdraw and optional for invoice
+	Destination *Destination `json:"destination,omitempty"`
+}
+
+type TransferRequest struct {
+	FromAccountId uint         `json:"fromAccountId"`
+	ToAccountId   uint         `json:"toAccountId"`
+	Amount        money.Amount `json:"amount"`
+	Currency      string       `json:"currency"`
+}
+
+// TransactionFilter selects a page of account transactions, zero fields are not filtered.
+type TransactionFilter struct {
+	AccountId   uint
+	Operation   Operation
+	Status      Status
+	Currency    string
+	MinAmount   *money.Amount
+	MaxAmount   *money.Amount
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+	Cursor      *TransactionCursor
+	Order       SortOrder
+	Limit       int
+}
+
+type TransactionPage struct {
+	Transactions []Transaction `json:"transactions"`
+	NextCursor   string        `json:"nextCursor,omitempty"`
+}
+
+// TransactionCursor points at the last transaction of the previous page.
+type TransactionCursor struct {
+	CreatedAt time.Time
+	Id        uint
+}
+
+func (c TransactionCursor) Encode() string {
+	raw := fmt.Sprintf("%d:%d", c.CreatedAt.UnixMicro(), c.Id)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func ParseTransactionCursor(s string) (TransactionCursor, error) {
+	var (
+		cursor TransactionCursor
+		micro  int64
+	)
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor, errs.ErrInvalidCursor
+	}
+	if _, err := fmt.Sscanf(string(raw), "%d:%d", &micro, &cursor.Id); err != nil {
+		return cursor, errs.ErrInvalidCursor
+	}
+	cursor.CreatedAt = time.UnixMicro(micro).UTC()
+	return cursor, nil
 }
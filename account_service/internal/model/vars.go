@@ -1,13 +1,48 @@
 package model
 
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
 type Operation int8
 
 const (
 	_ Operation = iota
 	Invoice
 	Withdraw
+	// Transfer moves funds between two accounts without the processor
+	Transfer
 )
 
+var operationNames = map[Operation]string{
+	Invoice:  "Invoice",
+	Withdraw: "Withdraw",
+	Transfer: "Transfer",
+}
+
+func (o Operation) String() string {
+	if name, ok := operationNames[o]; ok {
+		return name
+	}
+	return fmt.Sprintf("Operation(%d)", o)
+}
+
+func (o Operation) MarshalJSON() ([]byte, error) {
+	return json.Marshal(o.String())
+}
+
+// ParseOperation parses case-insensitive operation name.
+func ParseOperation(s string) (Operation, error) {
+	for op, name := range operationNames {
+		if strings.EqualFold(name, s) {
+			return op, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown operation %q", s)
+}
+
 type Status int8
 
 const (
@@ -16,3 +51,37 @@ const (
 	Error
 	Created
 )
+
+var statusNames = map[Status]string{
+	Success: "Success",
+	Error:   "Error",
+	Created: "Created",
+}
+
+func (s Status) String() string {
+	if name, ok := statusNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("Status(%d)", s)
+}
+
+func (s Status) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// ParseStatus parses case-insensitive status name.
+func ParseStatus(s string) (Status, error) {
+	for status, name := range statusNames {
+		if strings.EqualFold(name, s) {
+			return status, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown status %q", s)
+}
+
+type SortOrder string
+
+const (
+	Asc  SortOrder = "asc"
+	Desc SortOrder = "desc"
+)
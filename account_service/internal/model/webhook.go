@@ -0,0 +1,65 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	WebhooksTable          = "webhooks"
+	WebhookDeliveriesTable = "webhook_deliveries"
+	WebhookAttemptsTable   = "webhook_attempts"
+)
+
+// Webhook is an account callback notified when its invoices and withdrawals get a final status.
+type Webhook struct {
+	Id        uint   `json:"id"`
+	AccountId uint   `json:"accountId"`
+	Url       string `json:"url"`
+	// Secret signs the payloads, it is returned only on registration
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type WebhookRequest struct {
+	Url string `json:"url"`
+}
+
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliveryDelivered DeliveryStatus = "delivered"
+	// DeliveryFailed is set when all attempts failed, the delivery can be redelivered manually
+	DeliveryFailed DeliveryStatus = "failed"
+)
+
+// WebhookDelivery is the notification of one webhook about one final transaction status.
+// Payload is the transaction event.
+type WebhookDelivery struct {
+	Id            uint            `json:"id"`
+	WebhookId     uint            `json:"webhookId"`
+	TransactionId uint            `json:"transactionId"`
+	Url           string          `json:"url"`
+	Secret        string          `json:"-"`
+	Payload       json.RawMessage `json:"payload"`
+	Status        DeliveryStatus  `json:"status"`
+	Attempts      int             `json:"attempts"`
+	NextAttemptAt *time.Time      `json:"nextAttemptAt,omitempty"`
+	LastError     string          `json:"lastError,omitempty"`
+	CreatedAt     time.Time       `json:"createdAt"`
+	DeliveredAt   *time.Time      `json:"deliveredAt,omitempty"`
+	// Log is filled when a single delivery is requested
+	Log []WebhookAttempt `json:"log,omitempty"`
+}
+
+// WebhookAttempt is a delivery log record.
+type WebhookAttempt struct {
+	Attempt      int    `json:"attempt"`
+	ResponseCode int    `json:"responseCode,omitempty"`
+	Error        string `json:"error,omitempty"`
+	Delivered    bool   `json:"delivered"`
+	// NextAttemptAt is nil when the delivery is given up
+	NextAttemptAt *time.Time `json:"nextAttemptAt,omitempty"`
+	CreatedAt     time.Time  `json:"createdAt"`
+}
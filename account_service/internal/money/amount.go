@@ -0,0 +1,247 @@
+package money
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+var ErrInvalidAmount error = errors.New("invalid amount")
+
+// Parsed amounts are bounded, so calculations with a client amount can't build huge numbers.
+const (
+	maxDigits   = 38
+	maxExponent = 32
+)
+
+// Amount is an exact decimal number equal to coef * 10^exp.
+// The zero value is 0, amounts are immutable and safe to copy.
+type Amount struct {
+	coef *big.Int
+	exp  int32
+}
+
+var (
+	bigOne = big.NewInt(1)
+	bigTen = big.NewInt(10)
+)
+
+func New(coef int64, exp int32) Amount {
+	return Amount{coef: big.NewInt(coef), exp: exp}
+}
+
+// Parse reads a decimal number like "-12.50" or "1e3".
+// It accepts up to 38 digits and an exponent from -32 to 32.
+func Parse(s string) (Amount, error) {
+	mantissa, exp := s, int64(0)
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		var err error
+		if exp, err = strconv.ParseInt(s[i+1:], 10, 32); err != nil || exp < -maxExponent || exp > maxExponent {
+			return Amount{}, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+		}
+		mantissa = s[:i]
+	}
+
+	intPart, fracPart, _ := strings.Cut(mantissa, ".")
+	digits := strings.TrimLeft(intPart, "+-")
+	if len(intPart)-len(digits) > 1 || digits+fracPart == "" || strings.ContainsAny(fracPart, "+-") {
+		return Amount{}, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+	if len(digits)+len(fracPart) > maxDigits {
+		return Amount{}, fmt.Errorf("%w: %q has more than %d digits", ErrInvalidAmount, s, maxDigits)
+	}
+
+	coef, ok := new(big.Int).SetString(intPart+fracPart, 10)
+	if !ok {
+		return Amount{}, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+	return Amount{coef: coef, exp: int32(exp) - int32(len(fracPart))}, nil
+}
+
+// MustParse is Parse for constants, it panics on invalid input.
+func MustParse(s string) Amount {
+	a, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+func (a Amount) int() *big.Int {
+	if a.coef == nil {
+		return new(big.Int)
+	}
+	return a.coef
+}
+
+func pow10(n int32) *big.Int {
+	return new(big.Int).Exp(bigTen, big.NewInt(int64(n)), nil)
+}
+
+// align returns the coefficients of a and b scaled to the same exponent.
+func align(a, b Amount) (*big.Int, *big.Int, int32) {
+	x, y := a.int(), b.int()
+	switch {
+	case a.exp > b.exp:
+		return new(big.Int).Mul(x, pow10(a.exp-b.exp)), y, b.exp
+	case a.exp < b.exp:
+		return x, new(big.Int).Mul(y, pow10(b.exp-a.exp)), a.exp
+	}
+	return x, y, a.exp
+}
+
+func (a Amount) Add(b Amount) Amount {
+	x, y, exp := align(a, b)
+	return Amount{coef: new(big.Int).Add(x, y), exp: exp}
+}
+
+func (a Amount) Sub(b Amount) Amount {
+	x, y, exp := align(a, b)
+	return Amount{coef: new(big.Int).Sub(x, y), exp: exp}
+}
+
+func (a Amount) Neg() Amount {
+	return Amount{coef: new(big.Int).Neg(a.int()), exp: a.exp}
+}
+
+func (a Amount) Mul(b Amount) Amount {
+	return Amount{coef: new(big.Int).Mul(a.int(), b.int()), exp: a.exp + b.exp}
+}
+
+// Quo returns a/b rounded half away from zero to the given number of decimal places.
+// It panics if b is zero.
+func (a Amount) Quo(b Amount, places int32) Amount {
+	x, y := new(big.Int).Set(a.int()), new(big.Int).Set(b.int())
+	// a/b * 10^places = x/y * 10^(a.exp-b.exp+places)
+	if shift := a.exp - b.exp + places; shift >= 0 {
+		x.Mul(x, pow10(shift))
+	} else {
+		y.Mul(y, pow10(-shift))
+	}
+	return Amount{coef: quoRound(x, y), exp: -places}
+}
+
+// Round rounds half away from zero to the given number of decimal places.
+func (a Amount) Round(places int32) Amount {
+	if -a.exp <= places {
+		return a
+	}
+	return Amount{coef: quoRound(a.int(), pow10(-a.exp-places)), exp: -places}
+}
+
+func quoRound(x, y *big.Int) *big.Int {
+	q, r := new(big.Int).QuoRem(x, y, new(big.Int))
+	if r.Sign() == 0 {
+		return q
+	}
+	if new(big.Int).Abs(new(big.Int).Lsh(r, 1)).Cmp(new(big.Int).Abs(y)) >= 0 {
+		if x.Sign() == y.Sign() {
+			q.Add(q, bigOne)
+		} else {
+			q.Sub(q, bigOne)
+		}
+	}
+	return q
+}
+
+// Places returns the number of significant decimal places.
+func (a Amount) Places() int32 {
+	n := a.normalize()
+	if n.exp >= 0 {
+		return 0
+	}
+	return -n.exp
+}
+
+func (a Amount) Cmp(b Amount) int {
+	x, y, _ := align(a, b)
+	return x.Cmp(y)
+}
+
+func (a Amount) Equal(b Amount) bool {
+	return a.Cmp(b) == 0
+}
+
+func (a Amount) Sign() int {
+	return a.int().Sign()
+}
+
+func (a Amount) IsZero() bool {
+	return a.Sign() == 0
+}
+
+// normalize strips trailing zeros of the coefficient.
+func (a Amount) normalize() Amount {
+	coef, exp := new(big.Int).Set(a.int()), a.exp
+	if coef.Sign() == 0 {
+		return Amount{coef: coef}
+	}
+	r := new(big.Int)
+	for {
+		q, _ := new(big.Int).QuoRem(coef, bigTen, r)
+		if r.Sign() != 0 {
+			break
+		}
+		coef, exp = q, exp+1
+	}
+	return Amount{coef: coef, exp: exp}
+}
+
+// String formats the amount without exponent and trailing zeros, e.g. "831.32".
+func (a Amount) String() string {
+	n := a.normalize()
+	if n.exp >= 0 {
+		return new(big.Int).Mul(n.coef, pow10(n.exp)).String()
+	}
+
+	digits := new(big.Int).Abs(n.coef).String()
+	places := int(-n.exp)
+	if len(digits) <= places {
+		digits = strings.Repeat("0", places-len(digits)+1) + digits
+	}
+	s := digits[:len(digits)-places] + "." + digits[len(digits)-places:]
+	if n.coef.Sign() < 0 {
+		s = "-" + s
+	}
+	return s
+}
+
+// Float64 is for logging and metrics only, amounts must not be calculated in floats.
+func (a Amount) Float64() float64 {
+	f, _ := strconv.ParseFloat(a.String(), 64)
+	return f
+}
+
+// MarshalJSON encodes the amount as a JSON number.
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalJSON accepts a JSON number or a string with a number.
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	parsed, err := Parse(string(bytes.Trim(data, `"`)))
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
+
+// ScanNumeric implements pgtype.NumericScanner.
+func (a *Amount) ScanNumeric(v pgtype.Numeric) error {
+	if !v.Valid || v.NaN || v.InfinityModifier != pgtype.Finite {
+		return fmt.Errorf("%w: can't scan %v", ErrInvalidAmount, v)
+	}
+	*a = Amount{coef: new(big.Int).Set(v.Int), exp: v.Exp}
+	return nil
+}
+
+// NumericValue implements pgtype.NumericValuer.
+func (a Amount) NumericValue() (pgtype.Numeric, error) {
+	return pgtype.Numeric{Int: new(big.Int).Set(a.int()), Exp: a.exp, Valid: true}, nil
+}
@@ -0,0 +1,46 @@
+package money
+
+// minorUnits lists ISO 4217 currencies whose minor unit is not a hundredth.
+var minorUnits = map[string]int32{
+	"BHD": 3,
+	"BIF": 0,
+	"CLP": 0,
+	"DJF": 0,
+	"GNF": 0,
+	"IQD": 3,
+	"ISK": 0,
+	"JOD": 3,
+	"JPY": 0,
+	"KMF": 0,
+	"KRW": 0,
+	"KWD": 3,
+	"LYD": 3,
+	"OMR": 3,
+	"PYG": 0,
+	"RWF": 0,
+	"TND": 3,
+	"UGX": 0,
+	"VND": 0,
+	"VUV": 0,
+	"XAF": 0,
+	"XOF": 0,
+	"XPF": 0,
+}
+
+// MinorUnits returns the number of decimal places of the currency, 2 for most currencies.
+func MinorUnits(currency string) int32 {
+	if places, ok := minorUnits[currency]; ok {
+		return places
+	}
+	return 2
+}
+
+// RoundTo rounds the amount to the minor units of the currency.
+func (a Amount) RoundTo(currency string) Amount {
+	return a.Round(MinorUnits(currency))
+}
+
+// FitsCurrency reports whether the amount has no fractions of the currency minor unit.
+func (a Amount) FitsCurrency(currency string) bool {
+	return a.Places() <= MinorUnits(currency)
+}
@@ -5,82 +5,129 @@ import (
 	"fmt"
 
 	"accountservice/internal/model"
+	"accountservice/internal/money"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type AccountRepo interface {
-	InsertOne(c context.Context) (uint, error)
+	InsertOne(c context.Context, in model.AccountRequest) (model.Account, error)
 	FindOne(c context.Context, accountId uint) (model.Account, error)
 	FindAll(c context.Context) ([]model.Account, error)
-	UpdateOne(c context.Context, accountId uint, balanceChange, frozenChange float64) error
+	// UpdateOne is a manual correction, it is posted to the ledger against the adjustment account
+	UpdateOne(c context.Context, accountId uint, currency string, balanceChange, frozenChange money.Amount) error
+	Post(c context.Context, entry model.JournalEntry) (uint, error)
+	Reconcile(c context.Context, accountId uint) error
 }
 
 type accountPostgresRepo struct {
 	db *pgxpool.Pool
 }
 
-func NewAccountPostgresRepo(db *pgxpool.Pool) (AccountRepo, error) {
-	ctx := context.Background()
-	_, err := db.Exec(ctx, fmt.Sprintf(`
-		create table if not exists %s(
-			id serial primary key,
-			balance numeric not null,
-			frozen numeric not null,
-			created_at timestamp default current_timestamp,
-			updated_at timestamp default current_timestamp
-		)
-	`, model.AccountsTable))
-	return accountPostgresRepo{db}, err
+func NewAccountPostgresRepo(db *pgxpool.Pool) AccountRepo {
+	return accountPostgresRepo{db}
 }
 
-func (r accountPostgresRepo) InsertOne(c context.Context) (uint, error) {
-	var accountId uint
-	err := r.db.QueryRow(c, fmt.Sprintf(`
-		insert into %s(balance, frozen)
-		values (0, 0)
-		returning id
-	`, model.AccountsTable)).Scan(&accountId)
-	return accountId, err
+func (r accountPostgresRepo) InsertOne(c context.Context, in model.AccountRequest) (model.Account, error) {
+	a := model.Account{Wallets: []model.Wallet{}}
+	err := conn(c, r.db).QueryRow(c, fmt.Sprintf(`
+		insert into %s(owner_ref, currency)
+		values ($1, $2)
+		returning id, owner_ref, currency, created_at, updated_at
+	`, model.AccountsTable), in.OwnerRef, in.Currency).Scan(&a.Id, &a.OwnerRef, &a.Currency, &a.CreatedAt, &a.UpdatedAt)
+	return a, err
 }
 
 func (r accountPostgresRepo) FindOne(c context.Context, accountId uint) (model.Account, error) {
-	var a model.Account
-	err := r.db.QueryRow(c, fmt.Sprintf(`
-		select * from %s
+	a := model.Account{Wallets: []model.Wallet{}}
+	err := conn(c, r.db).QueryRow(c, fmt.Sprintf(`
+		select id, owner_ref, currency, created_at, updated_at from %s
 		where id = $1
-	`, model.AccountsTable), accountId).Scan(&a.Id, &a.Balance, &a.Frozen, &a.CreatedAt, &a.UpdatedAt)
-	return a, err
+	`, model.AccountsTable), accountId).Scan(&a.Id, &a.OwnerRef, &a.Currency, &a.CreatedAt, &a.UpdatedAt)
+	if err != nil {
+		return a, err
+	}
+
+	wallets, err := r.findWallets(c, accountId)
+	if err != nil {
+		return a, err
+	}
+	a.Wallets = append(a.Wallets, wallets[accountId]...)
+	return a, nil
 }
 
 func (r accountPostgresRepo) FindAll(c context.Context) ([]model.Account, error) {
 	var accounts []model.Account
-	rows, err := r.db.Query(c, fmt.Sprintf(`
-		select id, balance, frozen, created_at, updated_at from %s
+	rows, err := conn(c, r.db).Query(c, fmt.Sprintf(`
+		select id, owner_ref, currency, created_at, updated_at from %s
+		order by id
 	`, model.AccountsTable))
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var account model.Account
 	for rows.Next() {
-		if err := rows.Scan(&account.Id, &account.Balance, &account.Frozen, &account.CreatedAt, &account.UpdatedAt); err != nil {
+		account := model.Account{Wallets: []model.Wallet{}}
+		if err := rows.Scan(&account.Id, &account.OwnerRef, &account.Currency, &account.CreatedAt, &account.UpdatedAt); err != nil {
 			return nil, err
 		}
 		accounts = append(accounts, account)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	wallets, err := r.findWallets(c, 0)
+	if err != nil {
+		return nil, err
+	}
+	for i := range accounts {
+		accounts[i].Wallets = append(accounts[i].Wallets, wallets[accounts[i].Id]...)
+	}
 
 	return accounts, nil
 }
 
-func (r accountPostgresRepo) UpdateOne(c context.Context, accountId uint, balanceChange, frozenChange float64) error {
-	_, err := r.db.Exec(c, fmt.Sprintf(`
-		update %s
-		set balance = balance+$1, 
-			frozen = frozen+$2, 
-			updated_at = current_timestamp
-		where id = $3
-	`, model.AccountsTable), balanceChange, frozenChange, accountId)
+// findWallets returns wallets grouped by account id, accountId=0 selects wallets of all accounts.
+func (r accountPostgresRepo) findWallets(c context.Context, accountId uint) (map[uint][]model.Wallet, error) {
+	rows, err := conn(c, r.db).Query(c, fmt.Sprintf(`
+		select fk_account_id, currency, balance, frozen, updated_at from %s
+		where $1 = 0 or fk_account_id = $1
+		order by fk_account_id, currency
+	`, model.WalletsTable), accountId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var (
+		wallets = make(map[uint][]model.Wallet)
+		owner   uint
+		wallet  model.Wallet
+	)
+	for rows.Next() {
+		if err := rows.Scan(&owner, &wallet.Currency, &wallet.Balance, &wallet.Frozen, &wallet.UpdatedAt); err != nil {
+			return nil, err
+		}
+		wallets[owner] = append(wallets[owner], wallet)
+	}
+	return wallets, rows.Err()
+}
+
+func (r accountPostgresRepo) UpdateOne(c context.Context, accountId uint, currency string, balanceChange, frozenChange money.Amount) error {
+	entry := model.JournalEntry{Kind: model.Adjust}
+	if !balanceChange.IsZero() {
+		entry.Postings = append(entry.Postings, model.Posting{AccountId: accountId, Bucket: model.Available, Currency: currency, Amount: balanceChange})
+	}
+	if !frozenChange.IsZero() {
+		entry.Postings = append(entry.Postings, model.Posting{AccountId: accountId, Bucket: model.Frozen, Currency: currency, Amount: frozenChange})
+	}
+	if len(entry.Postings) == 0 {
+		return nil
+	}
+	entry.Postings = append(entry.Postings, model.Posting{Bucket: model.Adjustment, Currency: currency, Amount: balanceChange.Add(frozenChange).Neg()})
+
+	_, err := r.Post(c, entry)
 	return err
 }
@@ -0,0 +1,121 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"accountservice/internal/errs"
+	"accountservice/internal/model"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type DeadLetterRepo interface {
+	// InsertOne returns ErrUnknownTransaction if the transaction of the dead letter does not exist.
+	InsertOne(c context.Context, in model.DeadLetter) (uint, error)
+	// FindMany returns the dead letters which are not redriven yet, or all of them if all is set.
+	FindMany(c context.Context, all bool) ([]model.DeadLetter, error)
+	// Redrive queues the transaction of the dead letter again and marks the dead letter redriven.
+	// It returns errs.ErrFinalStatus if the transaction is already settled
+	// and pgx.ErrNoRows if the dead letter is unknown or already redriven.
+	Redrive(c context.Context, id uint) (model.DeadLetter, error)
+}
+
+const deadLetterColumns = "id, fk_transaction_id, reason, attempts, created_at, redriven_at"
+
+func scanDeadLetter(row pgx.Row, d *model.DeadLetter) error {
+	return row.Scan(&d.Id, &d.TransactionId, &d.Reason, &d.Attempts, &d.CreatedAt, &d.RedrivenAt)
+}
+
+type deadLetterPostgresRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewDeadLetterPostgresRepo(db *pgxpool.Pool) DeadLetterRepo {
+	return deadLetterPostgresRepo{db}
+}
+
+func (r deadLetterPostgresRepo) InsertOne(c context.Context, in model.DeadLetter) (uint, error) {
+	var id uint
+	err := conn(c, r.db).QueryRow(c, fmt.Sprintf(`
+		insert into %s(fk_transaction_id, reason, attempts)
+		values ($1, $2, $3)
+		returning id
+	`, model.DeadLettersTable), in.TransactionId, in.Reason, in.Attempts).Scan(&id)
+	return id, constraintError(err)
+}
+
+func (r deadLetterPostgresRepo) FindMany(c context.Context, all bool) ([]model.DeadLetter, error) {
+	rows, err := conn(c, r.db).Query(c, fmt.Sprintf(`
+		select %s
+		from %s
+		where $1 or redriven_at is null
+		order by id
+	`, deadLetterColumns, model.DeadLettersTable), all)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deadLetters := []model.DeadLetter{}
+	for rows.Next() {
+		var d model.DeadLetter
+		if err := scanDeadLetter(rows, &d); err != nil {
+			return nil, err
+		}
+		deadLetters = append(deadLetters, d)
+	}
+	return deadLetters, rows.Err()
+}
+
+func (r deadLetterPostgresRepo) Redrive(c context.Context, id uint) (model.DeadLetter, error) {
+	var d model.DeadLetter
+	tx, err := conn(c, r.db).Begin(c)
+	if err != nil {
+		return d, err
+	}
+	defer tx.Rollback(c)
+
+	// a settled transaction must not be processed again
+	err = scanDeadLetter(tx.QueryRow(c, fmt.Sprintf(`
+		update %[1]s d
+		set redriven_at = current_timestamp
+		from %[2]s t
+		where d.id = $1
+			and d.redriven_at is null
+			and t.id = d.fk_transaction_id
+			and t.status = $2
+		returning d.id, d.fk_transaction_id, d.reason, d.attempts, d.created_at, d.redriven_at
+	`, model.DeadLettersTable, model.TransactionsTable), id, model.Created), &d)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return d, r.redriveError(c, tx, id)
+	}
+	if err != nil {
+		return d, err
+	}
+
+	if err := insertOutbox(c, tx, d.TransactionId); err != nil {
+		return d, err
+	}
+	return d, tx.Commit(c)
+}
+
+// redriveError tells a pending dead letter of a settled transaction from an unknown or redriven one.
+func (r deadLetterPostgresRepo) redriveError(c context.Context, tx pgx.Tx, id uint) error {
+	var pending bool
+	err := tx.QueryRow(c, fmt.Sprintf(`
+		select exists(
+			select 1 from %s
+			where id = $1 and redriven_at is null
+		)
+	`, model.DeadLettersTable), id).Scan(&pending)
+	if err != nil {
+		return err
+	}
+	if pending {
+		return errs.ErrFinalStatus
+	}
+	return pgx.ErrNoRows
+}
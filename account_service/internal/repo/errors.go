@@ -0,0 +1,33 @@
+package repo
+
+import (
+	"errors"
+	"fmt"
+
+	"accountservice/internal/errs"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	checkViolation      = "23514"
+	foreignKeyViolation = "23503"
+)
+
+// constraintError maps the violated database invariants to errs, so they can be told apart from failures.
+// The database error stays wrapped, other errors are returned as is.
+func constraintError(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || (pgErr.Code != checkViolation && pgErr.Code != foreignKeyViolation) {
+		return err
+	}
+	switch pgErr.ConstraintName {
+	case "wallets_balance_nonnegative", "wallets_frozen_nonnegative":
+		return fmt.Errorf("%w: %w", errs.ErrNegativeBalance, err)
+	case "transactions_final_status":
+		return fmt.Errorf("%w: %w", errs.ErrFinalStatus, err)
+	case "dead_letters_fk_transaction_id_fkey":
+		return fmt.Errorf("%w: %w", errs.ErrUnknownTransaction, err)
+	}
+	return err
+}
@@ -0,0 +1,160 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"accountservice/internal/model"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type EventRepo interface {
+	// Relay locks up to limit unpublished events and passes them to publish by id.
+	// Ids are taken before commit and locked events are skipped, so a later relay can publish a lower id.
+	// Published events are marked, relaying stops at the first failed event.
+	Relay(c context.Context, limit int, publish func(model.Event) error) (int, error)
+	// Listen passes the events committed by any service instance to handle until c is done or the connection fails.
+	Listen(c context.Context, handle func(model.Event)) error
+	// FindByAccount returns up to limit events of the account with ids greater than afterId ordered by id.
+	// The account is matched by the expressions of the events account indexes.
+	FindByAccount(c context.Context, accountId, afterId uint, limit int) ([]model.Event, error)
+}
+
+type eventPostgresRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewEventPostgresRepo(db *pgxpool.Pool) EventRepo {
+	return eventPostgresRepo{db}
+}
+
+// insertEvent stores the event in the same database transaction as the change it describes,
+// the returned event has the id and the time set. Listeners are notified of the event id on commit.
+func insertEvent(c context.Context, tx querier, event model.Event) (model.Event, error) {
+	err := tx.QueryRow(c, fmt.Sprintf(`
+		insert into %s(type, version, routing_key, data)
+		values ($1, $2, $3, $4)
+		returning id, created_at
+	`, model.EventsTable), event.Type, event.Version, event.RoutingKey, event.Data).Scan(&event.Id, &event.OccurredAt)
+	if err != nil {
+		return event, err
+	}
+	_, err = tx.Exec(c, "select pg_notify($1, $2)", model.EventsChannel, strconv.FormatUint(uint64(event.Id), 10))
+	return event, err
+}
+
+func (r eventPostgresRepo) Relay(c context.Context, limit int, publish func(model.Event) error) (int, error) {
+	tx, err := conn(c, r.db).Begin(c)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(c)
+
+	rows, err := tx.Query(c, fmt.Sprintf(`
+		select id, type, version, routing_key, data, created_at
+		from %s
+		where published_at is null
+		order by id
+		limit $1
+		for update skip locked
+	`, model.EventsTable), limit)
+	if err != nil {
+		return 0, err
+	}
+
+	var events []model.Event
+	for rows.Next() {
+		var e model.Event
+		if err := rows.Scan(&e.Id, &e.Type, &e.Version, &e.RoutingKey, &e.Data, &e.OccurredAt); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		events = append(events, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	published := 0
+	for _, e := range events {
+		if err := publish(e); err != nil {
+			break
+		}
+		if _, err := tx.Exec(c, fmt.Sprintf(`
+			update %s
+			set published_at = current_timestamp
+			where id = $1
+		`, model.EventsTable), e.Id); err != nil {
+			return published, err
+		}
+		published++
+	}
+
+	return published, tx.Commit(c)
+}
+
+func (r eventPostgresRepo) Listen(c context.Context, handle func(model.Event)) error {
+	// notifications are received on the connection which listens, so a dedicated connection is held until the end
+	// instead of taking one of the pool for the process lifetime
+	listener, err := pgx.ConnectConfig(c, r.db.Config().ConnConfig.Copy())
+	if err != nil {
+		return err
+	}
+	defer listener.Close(context.Background())
+
+	if _, err := listener.Exec(c, "listen "+model.EventsChannel); err != nil {
+		return err
+	}
+
+	for {
+		notification, err := listener.WaitForNotification(c)
+		if err != nil {
+			return err
+		}
+		eventId, err := strconv.ParseUint(notification.Payload, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid event notification %q: %w", notification.Payload, err)
+		}
+
+		// notifications received meanwhile are buffered by the connection
+		var e model.Event
+		err = listener.QueryRow(c, fmt.Sprintf(`
+			select id, type, version, routing_key, data, created_at
+			from %s
+			where id = $1
+		`, model.EventsTable), eventId).Scan(&e.Id, &e.Type, &e.Version, &e.RoutingKey, &e.Data, &e.OccurredAt)
+		if err != nil {
+			return err
+		}
+		handle(e)
+	}
+}
+
+func (r eventPostgresRepo) FindByAccount(c context.Context, accountId, afterId uint, limit int) ([]model.Event, error) {
+	rows, err := conn(c, r.db).Query(c, fmt.Sprintf(`
+		select id, type, version, routing_key, data, created_at
+		from %s
+		where id > $1
+			and ((data->>'accountId')::int = $2 or (data->>'counterpartyId')::int = $2)
+		order by id
+		limit $3
+	`, model.EventsTable), afterId, accountId, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []model.Event{}
+	for rows.Next() {
+		var e model.Event
+		if err := rows.Scan(&e.Id, &e.Type, &e.Version, &e.RoutingKey, &e.Data, &e.OccurredAt); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,102 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"accountservice/internal/model"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type IdempotencyRepo interface {
+	// Reserve stores the key for a new request. If the key is already taken and not expired,
+	// the existing record is returned with reserved=false. A key without a response older than lease
+	// belongs to an abandoned request and is taken over.
+	Reserve(c context.Context, key, fingerprint string, retention, lease time.Duration) (record model.IdempotencyRecord, reserved bool, err error)
+	Complete(c context.Context, record model.IdempotencyRecord) error
+	Release(c context.Context, key string) error
+	// Purge deletes at most limit keys older than retention and returns their number.
+	Purge(c context.Context, retention time.Duration, limit int) (int, error)
+}
+
+type idempotencyPostgresRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewIdempotencyPostgresRepo(db *pgxpool.Pool) IdempotencyRepo {
+	return idempotencyPostgresRepo{db}
+}
+
+func (r idempotencyPostgresRepo) Reserve(c context.Context, key, fingerprint string, retention, lease time.Duration) (model.IdempotencyRecord, bool, error) {
+	var record model.IdempotencyRecord
+
+	// expired keys and keys of abandoned requests start over
+	reserved := true
+	err := r.db.QueryRow(c, fmt.Sprintf(`
+		insert into %s as k(key, fingerprint)
+		values ($1, $2)
+		on conflict (key) do update
+		set fingerprint = excluded.fingerprint,
+			status_code = 0,
+			content_type = '',
+			location = '',
+			response = null,
+			created_at = current_timestamp
+		where k.created_at < current_timestamp - make_interval(secs => $3)
+			or (k.status_code = 0 and k.created_at < current_timestamp - make_interval(secs => $4))
+		returning key, fingerprint, status_code, content_type, location, response, created_at
+	`, model.IdempotencyKeysTable), key, fingerprint, retention.Seconds(), lease.Seconds()).Scan(&record.Key, &record.Fingerprint, &record.StatusCode, &record.ContentType, &record.Location, &record.Response, &record.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		reserved = false
+		err = r.db.QueryRow(c, fmt.Sprintf(`
+			select key, fingerprint, status_code, content_type, location, response, created_at
+			from %s
+			where key = $1
+		`, model.IdempotencyKeysTable), key).Scan(&record.Key, &record.Fingerprint, &record.StatusCode, &record.ContentType, &record.Location, &record.Response, &record.CreatedAt)
+	}
+	if err != nil {
+		return record, false, err
+	}
+
+	return record, reserved, nil
+}
+
+func (r idempotencyPostgresRepo) Complete(c context.Context, record model.IdempotencyRecord) error {
+	_, err := r.db.Exec(c, fmt.Sprintf(`
+		update %s
+		set status_code = $1,
+			content_type = $2,
+			location = $3,
+			response = $4
+		where key = $5
+	`, model.IdempotencyKeysTable), record.StatusCode, record.ContentType, record.Location, record.Response, record.Key)
+	return err
+}
+
+func (r idempotencyPostgresRepo) Release(c context.Context, key string) error {
+	_, err := r.db.Exec(c, fmt.Sprintf(`
+		delete from %s
+		where key = $1
+	`, model.IdempotencyKeysTable), key)
+	return err
+}
+
+func (r idempotencyPostgresRepo) Purge(c context.Context, retention time.Duration, limit int) (int, error) {
+	tag, err := r.db.Exec(c, fmt.Sprintf(`
+		delete from %[1]s
+		where key in (
+			select key from %[1]s
+			where created_at < current_timestamp - make_interval(secs => $1)
+			order by created_at
+			limit $2
+		)
+	`, model.IdempotencyKeysTable), retention.Seconds(), limit)
+	if err != nil {
+		return 0, err
+	}
+	return int(tag.RowsAffected()), nil
+}
@@ -0,0 +1,160 @@
+package repo
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"accountservice/internal/errs"
+	"accountservice/internal/model"
+	"accountservice/internal/money"
+)
+
+type walletKey struct {
+	accountId uint
+	currency  string
+}
+
+type balanceDelta struct {
+	balance money.Amount
+	frozen  money.Amount
+}
+
+// Post writes a balanced journal entry and applies its postings to the account wallets
+// in a single database transaction.
+func (r accountPostgresRepo) Post(c context.Context, entry model.JournalEntry) (uint, error) {
+	tx, err := conn(c, r.db).Begin(c)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(c)
+
+	entryId, err := postEntry(c, tx, entry)
+	if err != nil {
+		return 0, err
+	}
+	return entryId, tx.Commit(c)
+}
+
+// postEntry writes the entry within the given database transaction.
+func postEntry(c context.Context, tx querier, entry model.JournalEntry) (uint, error) {
+	if !entry.Balanced() {
+		return 0, errs.ErrUnbalancedEntry
+	}
+
+	var entryId uint
+	err := tx.QueryRow(c, fmt.Sprintf(`
+		insert into %s(fk_transaction_id, kind)
+		values ($1, $2)
+		returning id
+	`, model.JournalEntriesTable), nullableId(entry.TransactionId), entry.Kind).Scan(&entryId)
+	if err != nil {
+		return 0, err
+	}
+
+	deltas := make(map[walletKey]balanceDelta)
+	for _, p := range entry.Postings {
+		if _, err := tx.Exec(c, fmt.Sprintf(`
+			insert into %s(fk_journal_entry_id, fk_account_id, bucket, currency, amount)
+			values ($1, $2, $3, $4, $5)
+		`, model.PostingsTable), entryId, nullableId(p.AccountId), p.Bucket, p.Currency, p.Amount); err != nil {
+			return 0, err
+		}
+
+		if p.Bucket.IsSystem() {
+			continue
+		}
+		key := walletKey{p.AccountId, p.Currency}
+		d := deltas[key]
+		switch p.Bucket {
+		case model.Available:
+			d.balance = d.balance.Add(p.Amount)
+		case model.Frozen:
+			d.frozen = d.frozen.Add(p.Amount)
+		}
+		deltas[key] = d
+	}
+
+	// wallets are always locked in the same order to avoid deadlocks
+	keys := make([]walletKey, 0, len(deltas))
+	for key := range deltas {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b walletKey) int {
+		if a.accountId != b.accountId {
+			return cmp.Compare(a.accountId, b.accountId)
+		}
+		return strings.Compare(a.currency, b.currency)
+	})
+
+	for _, key := range keys {
+		d := deltas[key]
+		changed := model.BalanceChanged{
+			AccountId:     key.accountId,
+			TransactionId: entry.TransactionId,
+			Currency:      key.currency,
+			BalanceChange: d.balance,
+			FrozenChange:  d.frozen,
+		}
+		if err := tx.QueryRow(c, fmt.Sprintf(`
+			insert into %[1]s(fk_account_id, currency, balance, frozen)
+			values ($1, $2, $3, $4)
+			on conflict (fk_account_id, currency) do update
+			set balance = %[1]s.balance+excluded.balance,
+				frozen = %[1]s.frozen+excluded.frozen,
+				updated_at = current_timestamp
+			returning balance, frozen
+		`, model.WalletsTable), key.accountId, key.currency, d.balance, d.frozen).Scan(&changed.Balance, &changed.Frozen); err != nil {
+			return 0, constraintError(err)
+		}
+
+		event, err := model.NewBalanceChangedEvent(changed)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := insertEvent(c, tx, event); err != nil {
+			return 0, err
+		}
+	}
+
+	return entryId, nil
+}
+
+// Reconcile checks that the stored wallet balances of the account match the sum of its postings.
+func (r accountPostgresRepo) Reconcile(c context.Context, accountId uint) error {
+	var mismatches int
+	err := conn(c, r.db).QueryRow(c, fmt.Sprintf(`
+		select count(*)
+		from (
+			select currency, balance, frozen from %s
+			where fk_account_id = $1
+		) w
+		full join (
+			select currency,
+				coalesce(sum(amount) filter (where bucket = $2), 0) as balance,
+				coalesce(sum(amount) filter (where bucket = $3), 0) as frozen
+			from %s
+			where fk_account_id = $1
+			group by currency
+		) p on p.currency = w.currency
+		where coalesce(w.balance, 0) <> coalesce(p.balance, 0)
+			or coalesce(w.frozen, 0) <> coalesce(p.frozen, 0)
+	`, model.WalletsTable, model.PostingsTable), accountId, model.Available, model.Frozen).Scan(&mismatches)
+	if err != nil {
+		return err
+	}
+	if mismatches > 0 {
+		return errs.ErrLedgerMismatch
+	}
+	return nil
+}
+
+// nullableId maps zero ids of system accounts and unbound entries to null.
+func nullableId(id uint) any {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
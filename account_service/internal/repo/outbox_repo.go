@@ -0,0 +1,158 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"accountservice/internal/model"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type OutboxRepo interface {
+	// Relay claims up to limit unsent messages for the lease and passes them to publish by id outside of the database transaction.
+	// Published messages are marked as sent and returned, relaying stops at the first failed message.
+	// The lease must cover the publishes of the whole batch, an expired claim is published again.
+	Relay(c context.Context, limit int, lease time.Duration, publish func(model.OutboxMessage) error) ([]model.OutboxMessage, error)
+	// Requeue queues again created transactions that were published more than threshold ago
+	// and have not been settled, it returns the number of queued transactions.
+	// Dead-lettered transactions are left until they are redriven.
+	Requeue(c context.Context, threshold time.Duration) (int, error)
+}
+
+type outboxPostgresRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewOutboxPostgresRepo(db *pgxpool.Pool) OutboxRepo {
+	return outboxPostgresRepo{db}
+}
+
+// insertOutbox stores the message in the same database transaction as the transaction row.
+func insertOutbox(c context.Context, tx querier, transactionId uint) error {
+	_, err := tx.Exec(c, fmt.Sprintf(`
+		insert into %s(fk_transaction_id)
+		values ($1)
+	`, model.OutboxTable), transactionId)
+	return err
+}
+
+func (r outboxPostgresRepo) Relay(c context.Context, limit int, lease time.Duration, publish func(model.OutboxMessage) error) ([]model.OutboxMessage, error) {
+	messages, err := r.claim(c, limit, lease)
+	if err != nil {
+		return nil, err
+	}
+
+	// the messages are published outside of any database transaction, so a slow broker holds no locks and connections
+	var sent []model.OutboxMessage
+	for i, msg := range messages {
+		if err := publish(msg); err != nil {
+			if _, err := conn(c, r.db).Exec(c, fmt.Sprintf(`
+				update %s
+				set attempts = attempts+1,
+					last_error = $1
+				where id = $2
+			`, model.OutboxTable), err.Error(), msg.Id); err != nil {
+				return sent, err
+			}
+			// the failed message and the ones after it are released for the next relay
+			return sent, r.release(c, messages[i:])
+		}
+
+		if _, err := conn(c, r.db).Exec(c, fmt.Sprintf(`
+			update %s
+			set attempts = attempts+1,
+				sent_at = current_timestamp,
+				locked_until = null
+			where id = $1
+		`, model.OutboxTable), msg.Id); err != nil {
+			return sent, err
+		}
+		sent = append(sent, msg)
+	}
+	return sent, nil
+}
+
+// claim locks up to limit unsent messages for the lease, so they are not published by other instances
+// while they are published. A claimed message is published again after the lease if it is not marked as sent.
+func (r outboxPostgresRepo) claim(c context.Context, limit int, lease time.Duration) ([]model.OutboxMessage, error) {
+	// skip locked lets several service instances claim messages at once
+	rows, err := conn(c, r.db).Query(c, fmt.Sprintf(`
+		with due as (
+			select id
+			from %[1]s
+			where sent_at is null
+				and (locked_until is null or locked_until <= current_timestamp)
+			order by id
+			limit $1
+			for update skip locked
+		)
+		update %[1]s o
+		set locked_until = current_timestamp + make_interval(secs => $2)
+		from due
+		where o.id = due.id
+		returning o.id, o.fk_transaction_id, o.attempts, o.created_at
+	`, model.OutboxTable), limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []model.OutboxMessage
+	for rows.Next() {
+		var msg model.OutboxMessage
+		if err := rows.Scan(&msg.Id, &msg.TransactionId, &msg.Attempts, &msg.CreatedAt); err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// returning keeps no order
+	sort.Slice(messages, func(i, j int) bool {
+		return messages[i].Id < messages[j].Id
+	})
+	return messages, nil
+}
+
+func (r outboxPostgresRepo) release(c context.Context, messages []model.OutboxMessage) error {
+	ids := make([]int64, len(messages))
+	for i, msg := range messages {
+		ids[i] = int64(msg.Id)
+	}
+	_, err := conn(c, r.db).Exec(c, fmt.Sprintf(`
+		update %s
+		set locked_until = null
+		where id = any($1)
+	`, model.OutboxTable), ids)
+	return err
+}
+
+func (r outboxPostgresRepo) Requeue(c context.Context, threshold time.Duration) (int, error) {
+	// transactions created before the outbox have no messages at all
+	tag, err := conn(c, r.db).Exec(c, fmt.Sprintf(`
+		insert into %[1]s(fk_transaction_id)
+		select t.id
+		from %[2]s t
+		where t.status = $1
+			and t.operation in ($2, $3)
+			and t.created_at < current_timestamp - make_interval(secs => $4)
+			and not exists (
+				select 1 from %[1]s o
+				where o.fk_transaction_id = t.id
+					and (o.sent_at is null or o.sent_at >= current_timestamp - make_interval(secs => $4))
+			)
+			and not exists (
+				select 1 from %[3]s d
+				where d.fk_transaction_id = t.id
+					and d.redriven_at is null
+			)
+	`, model.OutboxTable, model.TransactionsTable, model.DeadLettersTable), model.Created, model.Invoice, model.Withdraw, threshold.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	return int(tag.RowsAffected()), nil
+}
@@ -0,0 +1,125 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"accountservice/internal/model"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type RateRepo interface {
+	// InsertMany stores the rates which differ from the latest stored ones by value, nominal or source, valid from now.
+	// It returns the number of stored rates.
+	InsertMany(c context.Context, rates []model.Rate) (int, error)
+	FindLatest(c context.Context) ([]model.Rate, error)
+	// FindHistory returns the rates of the currency applied in [from, to), zero bounds are not limited.
+	FindHistory(c context.Context, currency string, from, to time.Time) ([]model.Rate, error)
+}
+
+const rateColumns = "currency, value, nominal, source, valid_from"
+
+func scanRate(row pgx.Row, r *model.Rate, extra ...any) error {
+	return row.Scan(append([]any{&r.Currency, &r.Value, &r.Nominal, &r.Source, &r.ValidFrom}, extra...)...)
+}
+
+type ratePostgresRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewRatePostgresRepo(db *pgxpool.Pool) RateRepo {
+	return ratePostgresRepo{db}
+}
+
+func (r ratePostgresRepo) InsertMany(c context.Context, rates []model.Rate) (int, error) {
+	tx, err := conn(c, r.db).Begin(c)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(c)
+
+	inserted := 0
+	for _, rate := range rates {
+		tag, err := tx.Exec(c, fmt.Sprintf(`
+			insert into %[1]s(currency, value, nominal, source)
+			select $1::text, $2::numeric, $3::numeric, $4::text
+			where not exists (
+				select 1 from (
+					select value, nominal, source from %[1]s
+					where currency = $1
+					order by valid_from desc, id desc
+					limit 1
+				) latest
+				where latest.value = $2 and latest.nominal = $3 and latest.source = $4
+			)
+		`, model.RatesTable), rate.Currency, rate.Value, rate.Nominal, rate.Source)
+		if err != nil {
+			return 0, err
+		}
+		inserted += int(tag.RowsAffected())
+	}
+
+	return inserted, tx.Commit(c)
+}
+
+func (r ratePostgresRepo) FindLatest(c context.Context) ([]model.Rate, error) {
+	rows, err := conn(c, r.db).Query(c, fmt.Sprintf(`
+		select distinct on (currency) %s
+		from %s
+		order by currency, valid_from desc, id desc
+	`, rateColumns, model.RatesTable))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rates := []model.Rate{}
+	for rows.Next() {
+		var rate model.Rate
+		if err := scanRate(rows, &rate); err != nil {
+			return nil, err
+		}
+		rates = append(rates, rate)
+	}
+	return rates, rows.Err()
+}
+
+func (r ratePostgresRepo) FindHistory(c context.Context, currency string, from, to time.Time) ([]model.Rate, error) {
+	var fromArg, toArg any
+	if !from.IsZero() {
+		fromArg = from
+	}
+	if !to.IsZero() {
+		toArg = to
+	}
+
+	// the rate valid at the start of the range is included as well
+	rows, err := conn(c, r.db).Query(c, fmt.Sprintf(`
+		select %s, valid_to
+		from (
+			select *, lead(valid_from) over (order by valid_from, id) as valid_to
+			from %s
+			where currency = $1
+		) h
+		where ($3::timestamptz is null or valid_from < $3)
+			and ($2::timestamptz is null or valid_to is null or valid_to > $2)
+		order by valid_from, id
+	`, rateColumns, model.RatesTable), currency, fromArg, toArg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rates := []model.Rate{}
+	for rows.Next() {
+		var rate model.Rate
+		if err := scanRate(rows, &rate, &rate.ValidTo); err != nil {
+			return nil, err
+		}
+		rates = append(rates, rate)
+	}
+	return rates, rows.Err()
+}
@@ -2,64 +2,320 @@ package repo
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 
+	"accountservice/internal/errs"
 	"accountservice/internal/model"
+	"accountservice/internal/money"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type TransactionRepo interface {
-	InsertOne(c context.Context, in model.TransactionRequest, op model.Operation) (uint, error)
+	// InsertOne stores a created transaction and queues it in the outbox.
+	InsertOne(c context.Context, in model.TransactionRequest, op model.Operation, fx model.FX) (model.Transaction, error)
 	FindOne(c context.Context, transactionId uint) (model.Transaction, error)
+	// UpdateOne fails with errs.ErrFinalStatus if the transaction already has another final status.
+	// No endpoint sets the status directly, the redrive of a settled transaction fails with the same error
+	// and is answered with 409 Conflict.
 	UpdateOne(c context.Context, transactionId uint, status model.Status) error
+	// Finalize sets the final status of a created transaction and queues the webhooks of its account.
+	// It reports false instead of errs.ErrFinalStatus if the transaction already has a final status.
+	Finalize(c context.Context, transactionId uint, status model.Status) (model.Transaction, bool, error)
+	FindPage(c context.Context, filter model.TransactionFilter) (model.TransactionPage, error)
+	// InsertTransfer stores a successful transfer if the source wallet has enough funds.
+	// The wallets of both accounts stay locked until the unit of work commits, so the transfer entry must be posted in it.
+	// It fails with errs.ErrNoUnitOfWork outside of a unit of work.
+	InsertTransfer(c context.Context, in model.TransferRequest, fx model.FX) (model.Transaction, error)
+}
+
+const transactionColumns = "id, fk_account_id, coalesce(fk_counterparty_account_id, 0), amount, currency, converted_amount, rate, rate_source, rate_valid_from, operation, status, destination_type, destination, created_at"
+
+func scanTransaction(row pgx.Row, t *model.Transaction) error {
+	var destinationType, destination, rateSource *string
+	if err := row.Scan(&t.Id, &t.AccountId, &t.CounterpartyId, &t.Amount, &t.Currency, &t.ConvertedAmount, &t.Rate, &rateSource, &t.RateValidFrom, &t.Operation, &t.Status, &destinationType, &destination, &t.CreatedAt); err != nil {
+		return err
+	}
+	t.RateSource = ""
+	if rateSource != nil {
+		t.RateSource = *rateSource
+	}
+	t.Destination = nil
+	if destinationType != nil && destination != nil {
+		t.Destination = &model.Destination{Type: model.DestinationType(*destinationType), Number: *destination}
+	}
+	return nil
+}
+
+// nullableString maps empty strings to null.
+func nullableString(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func destinationColumns(d *model.Destination) (destinationType, destination any) {
+	if d == nil {
+		return nil, nil
+	}
+	return string(d.Type), d.Number
 }
 
 type transactionPostgresRepo struct {
 	db *pgxpool.Pool
 }
 
-func NewTransactionPostgresRepo(db *pgxpool.Pool) (TransactionRepo, error) {
-	ctx := context.Background()
-	_, err := db.Exec(ctx, fmt.Sprintf(`
-		create table if not exists %s(
-			id serial primary key,
-			fk_account_id int references %s(id),
-			amount numeric not null,
-			currency text not null,
-			operation smallint not null,
-			status smallint not null,
-			created_at timestamp default current_timestamp
-		)
-	`, model.TransactionsTable, model.AccountsTable))
-	return transactionPostgresRepo{db}, err
+func NewTransactionPostgresRepo(db *pgxpool.Pool) TransactionRepo {
+	return transactionPostgresRepo{db}
 }
 
-func (r transactionPostgresRepo) InsertOne(c context.Context, in model.TransactionRequest, op model.Operation) (uint, error) {
-	var transactionId uint
-	err := r.db.QueryRow(c, fmt.Sprintf(`
-		insert into %s(fk_account_id, amount, currency, operation, status)
-		values ($1, $2, $3, $4, $5)
-		returning id
-	`, model.TransactionsTable), in.AccountId, in.Amount, in.Currency, op, model.Created).Scan(&transactionId)
-	return transactionId, err
+func (r transactionPostgresRepo) InsertOne(c context.Context, in model.TransactionRequest, op model.Operation, fx model.FX) (model.Transaction, error) {
+	transaction := model.Transaction{
+		AccountId:   in.AccountId,
+		Amount:      in.Amount,
+		Currency:    in.Currency,
+		FX:          fx,
+		Operation:   op,
+		Status:      model.Created,
+		Destination: in.Destination,
+	}
+
+	tx, err := conn(c, r.db).Begin(c)
+	if err != nil {
+		return transaction, err
+	}
+	defer tx.Rollback(c)
+
+	destinationType, destination := destinationColumns(in.Destination)
+	err = tx.QueryRow(c, fmt.Sprintf(`
+		insert into %s(fk_account_id, amount, currency, converted_amount, rate, rate_source, rate_valid_from, operation, status, destination_type, destination)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		returning id, created_at
+	`, model.TransactionsTable), in.AccountId, in.Amount, in.Currency, fx.ConvertedAmount, fx.Rate, nullableString(fx.RateSource), fx.RateValidFrom, op, model.Created, destinationType, destination).Scan(&transaction.Id, &transaction.CreatedAt)
+	if err != nil {
+		return transaction, err
+	}
+
+	if err := insertOutbox(c, tx, transaction.Id); err != nil {
+		return transaction, err
+	}
+	if _, err := insertTransactionEvent(c, tx, transaction); err != nil {
+		return transaction, err
+	}
+
+	return transaction, tx.Commit(c)
 }
 
 func (r transactionPostgresRepo) FindOne(c context.Context, transactionId uint) (model.Transaction, error) {
 	var transaction model.Transaction
-	err := r.db.QueryRow(c, fmt.Sprintf(`
-		select id, fk_account_id, amount, currency, operation, status, created_at
+	err := scanTransaction(conn(c, r.db).QueryRow(c, fmt.Sprintf(`
+		select %s
 		from %s
 		where id=$1
-	`, model.TransactionsTable), transactionId).Scan(&transaction.Id, &transaction.AccountId, &transaction.Amount, &transaction.Currency, &transaction.Operation, &transaction.Status, &transaction.CreatedAt)
+	`, transactionColumns, model.TransactionsTable), transactionId), &transaction)
 	return transaction, err
 }
 
 func (r transactionPostgresRepo) UpdateOne(c context.Context, transactionId uint, status model.Status) error {
-	_, err := r.db.Exec(c, fmt.Sprintf(`
+	// the final status is guarded by the transactions_final_status trigger
+	tag, err := conn(c, r.db).Exec(c, fmt.Sprintf(`
 		update %s
 		set status=$1
 		where id=$2
 	`, model.TransactionsTable), status, transactionId)
-	return err
+	if err != nil {
+		return constraintError(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+func (r transactionPostgresRepo) Finalize(c context.Context, transactionId uint, status model.Status) (model.Transaction, bool, error) {
+	var transaction model.Transaction
+	tx, err := conn(c, r.db).Begin(c)
+	if err != nil {
+		return transaction, false, err
+	}
+	defer tx.Rollback(c)
+
+	// the status guard makes concurrent finalization of the same transaction succeed once
+	err = scanTransaction(tx.QueryRow(c, fmt.Sprintf(`
+		update %s
+		set status=$1
+		where id=$2 and status=$3
+		returning %s
+	`, model.TransactionsTable, transactionColumns), status, transactionId, model.Created), &transaction)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return transaction, false, nil
+	}
+	if err != nil {
+		return transaction, false, err
+	}
+
+	event, err := insertTransactionEvent(c, tx, transaction)
+	if err != nil {
+		return transaction, false, err
+	}
+	if err := insertWebhookDeliveries(c, tx, transaction, event); err != nil {
+		return transaction, false, err
+	}
+	return transaction, true, tx.Commit(c)
+}
+
+// insertTransactionEvent stores the event of the current transaction status.
+func insertTransactionEvent(c context.Context, tx querier, t model.Transaction) (model.Event, error) {
+	event, err := model.NewTransactionEvent(t)
+	if err != nil {
+		return event, err
+	}
+	return insertEvent(c, tx, event)
+}
+
+func (r transactionPostgresRepo) FindPage(c context.Context, filter model.TransactionFilter) (model.TransactionPage, error) {
+	var (
+		page  = model.TransactionPage{Transactions: make([]model.Transaction, 0, filter.Limit)}
+		conds = []string{"(fk_account_id = $1 or fk_counterparty_account_id = $1)"}
+		args  = []any{filter.AccountId}
+	)
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if filter.Operation != 0 {
+		conds = append(conds, "operation = "+arg(filter.Operation))
+	}
+	if filter.Status != 0 {
+		conds = append(conds, "status = "+arg(filter.Status))
+	}
+	if filter.Currency != "" {
+		conds = append(conds, "currency = "+arg(filter.Currency))
+	}
+	if filter.MinAmount != nil {
+		conds = append(conds, "amount >= "+arg(*filter.MinAmount))
+	}
+	if filter.MaxAmount != nil {
+		conds = append(conds, "amount <= "+arg(*filter.MaxAmount))
+	}
+	if !filter.CreatedFrom.IsZero() {
+		conds = append(conds, "created_at >= "+arg(filter.CreatedFrom))
+	}
+	if !filter.CreatedTo.IsZero() {
+		conds = append(conds, "created_at < "+arg(filter.CreatedTo))
+	}
+
+	order, cmp := "asc", ">"
+	if filter.Order == model.Desc {
+		order, cmp = "desc", "<"
+	}
+	if filter.Cursor != nil {
+		conds = append(conds, fmt.Sprintf("(created_at, id) %s (%s, %s)", cmp, arg(filter.Cursor.CreatedAt), arg(filter.Cursor.Id)))
+	}
+
+	// one extra row tells whether there is a next page
+	rows, err := conn(c, r.db).Query(c, fmt.Sprintf(`
+		select %s
+		from %s
+		where %s
+		order by created_at %s, id %s
+		limit %s
+	`, transactionColumns, model.TransactionsTable, strings.Join(conds, " and "), order, order, arg(filter.Limit+1)), args...)
+	if err != nil {
+		return page, err
+	}
+	defer rows.Close()
+
+	var transaction model.Transaction
+	for rows.Next() {
+		if err := scanTransaction(rows, &transaction); err != nil {
+			return page, err
+		}
+		page.Transactions = append(page.Transactions, transaction)
+	}
+	if err := rows.Err(); err != nil {
+		return page, err
+	}
+
+	if len(page.Transactions) > filter.Limit {
+		page.Transactions = page.Transactions[:filter.Limit]
+		last := page.Transactions[filter.Limit-1]
+		page.NextCursor = model.TransactionCursor{CreatedAt: last.CreatedAt, Id: last.Id}.Encode()
+	}
+
+	return page, nil
+}
+
+func (r transactionPostgresRepo) InsertTransfer(c context.Context, in model.TransferRequest, fx model.FX) (model.Transaction, error) {
+	transaction := model.Transaction{
+		AccountId:      in.FromAccountId,
+		CounterpartyId: in.ToAccountId,
+		Amount:         in.Amount,
+		Currency:       in.Currency,
+		FX:             fx,
+		Operation:      model.Transfer,
+		Status:         model.Success,
+	}
+
+	tx, err := currentTx(c)
+	if err != nil {
+		return transaction, err
+	}
+
+	// the wallets of both accounts are locked until commit in the order postEntry updates them,
+	// so concurrent transfers can't overdraw the source or deadlock on opposite directions
+	rows, err := tx.Query(c, fmt.Sprintf(`
+		select fk_account_id, currency, balance from %s
+		where fk_account_id in ($1, $2)
+		order by fk_account_id, currency collate "C"
+		for update
+	`, model.WalletsTable), in.FromAccountId, in.ToAccountId)
+	if err != nil {
+		return transaction, err
+	}
+	var balance money.Amount
+	for rows.Next() {
+		var (
+			accountId     uint
+			currency      string
+			walletBalance money.Amount
+		)
+		if err := rows.Scan(&accountId, &currency, &walletBalance); err != nil {
+			rows.Close()
+			return transaction, err
+		}
+		if accountId == in.FromAccountId && currency == in.Currency {
+			balance = walletBalance
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return transaction, err
+	}
+	if balance.Cmp(in.Amount) < 0 {
+		return transaction, errs.ErrInsufficientFunds
+	}
+
+	err = tx.QueryRow(c, fmt.Sprintf(`
+		insert into %s(fk_account_id, fk_counterparty_account_id, amount, currency, converted_amount, rate, rate_source, rate_valid_from, operation, status)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		returning id, created_at
+	`, model.TransactionsTable), transaction.AccountId, transaction.CounterpartyId, transaction.Amount, transaction.Currency, fx.ConvertedAmount, fx.Rate, nullableString(fx.RateSource), fx.RateValidFrom, transaction.Operation, transaction.Status).Scan(&transaction.Id, &transaction.CreatedAt)
+	if err != nil {
+		return transaction, err
+	}
+
+	// a transfer is created already succeeded
+	created := transaction
+	created.Status = model.Created
+	if _, err := insertTransactionEvent(c, tx, created); err != nil {
+		return transaction, err
+	}
+	_, err = insertTransactionEvent(c, tx, transaction)
+	return transaction, err
 }
@@ -0,0 +1,66 @@
+package repo
+
+import (
+	"context"
+
+	"accountservice/internal/errs"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// UnitOfWork runs several repository calls in one database transaction.
+type UnitOfWork interface {
+	// Do commits if fn returns nil and rolls back otherwise. Repositories called with the context
+	// passed to fn join the transaction, a nested Do runs in a savepoint.
+	Do(c context.Context, fn func(c context.Context) error) error
+}
+
+type txKey struct{}
+
+// querier is implemented by both the pool and a transaction, Begin on a transaction creates a savepoint.
+type querier interface {
+	Begin(c context.Context) (pgx.Tx, error)
+	Exec(c context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(c context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(c context.Context, sql string, args ...any) pgx.Row
+}
+
+// conn returns the transaction of the current unit of work or the pool if there is none.
+func conn(c context.Context, db *pgxpool.Pool) querier {
+	if tx, ok := c.Value(txKey{}).(pgx.Tx); ok {
+		return tx
+	}
+	return db
+}
+
+// currentTx returns the transaction of the current unit of work, for calls whose locks must last until its commit.
+func currentTx(c context.Context) (pgx.Tx, error) {
+	tx, ok := c.Value(txKey{}).(pgx.Tx)
+	if !ok {
+		return nil, errs.ErrNoUnitOfWork
+	}
+	return tx, nil
+}
+
+type pgUnitOfWork struct {
+	db *pgxpool.Pool
+}
+
+func NewUnitOfWork(db *pgxpool.Pool) UnitOfWork {
+	return pgUnitOfWork{db}
+}
+
+func (u pgUnitOfWork) Do(c context.Context, fn func(c context.Context) error) error {
+	tx, err := conn(c, u.db).Begin(c)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(c)
+
+	if err := fn(context.WithValue(c, txKey{}, tx)); err != nil {
+		return err
+	}
+	return tx.Commit(c)
+}
@@ -0,0 +1,296 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"accountservice/internal/model"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type WebhookRepo interface {
+	InsertOne(c context.Context, accountId uint, url, secret string) (model.Webhook, error)
+	// FindByAccount returns the registered webhooks without secrets.
+	FindByAccount(c context.Context, accountId uint) ([]model.Webhook, error)
+	// DeleteOne unregisters the webhook, its pending deliveries are not sent anymore.
+	DeleteOne(c context.Context, accountId, webhookId uint) error
+	// FindDeliveries returns the deliveries of the account webhooks, an empty status is not filtered.
+	FindDeliveries(c context.Context, accountId uint, status model.DeliveryStatus) ([]model.WebhookDelivery, error)
+	// FindDelivery returns the delivery of the account webhooks with its attempts log.
+	FindDelivery(c context.Context, accountId, deliveryId uint) (model.WebhookDelivery, error)
+	// Redeliver schedules a failed delivery of the account webhooks again, pgx.ErrNoRows is returned for other deliveries.
+	Redeliver(c context.Context, accountId, deliveryId uint) (model.WebhookDelivery, error)
+	// Deliver claims up to limit due deliveries for the lease and passes them to deliver outside of the database transaction,
+	// the returned attempt is logged and decides the delivery status. It returns the number of attempts.
+	// The lease must cover the attempts of the whole batch, an expired claim is attempted again.
+	Deliver(c context.Context, limit int, lease time.Duration, deliver func(model.WebhookDelivery) model.WebhookAttempt) (int, error)
+}
+
+const deliveryColumns = "d.id, d.fk_webhook_id, d.fk_transaction_id, w.url, w.secret, d.payload, d.status, d.attempts, d.next_attempt_at, coalesce(d.last_error, ''), d.created_at, d.delivered_at"
+
+func scanDelivery(row pgx.Row, d *model.WebhookDelivery) error {
+	return row.Scan(&d.Id, &d.WebhookId, &d.TransactionId, &d.Url, &d.Secret, &d.Payload, &d.Status, &d.Attempts, &d.NextAttemptAt, &d.LastError, &d.CreatedAt, &d.DeliveredAt)
+}
+
+type webhookPostgresRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewWebhookPostgresRepo(db *pgxpool.Pool) WebhookRepo {
+	return webhookPostgresRepo{db}
+}
+
+// insertWebhookDeliveries queues the event for every webhook of the transaction account
+// in the same database transaction as the final status.
+func insertWebhookDeliveries(c context.Context, tx querier, t model.Transaction, event model.Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(c, fmt.Sprintf(`
+		insert into %s(fk_webhook_id, fk_transaction_id, payload)
+		select id, $1, $2
+		from %s
+		where fk_account_id = $3 and deleted_at is null
+	`, model.WebhookDeliveriesTable, model.WebhooksTable), t.Id, payload, t.AccountId)
+	return err
+}
+
+func (r webhookPostgresRepo) InsertOne(c context.Context, accountId uint, url, secret string) (model.Webhook, error) {
+	w := model.Webhook{AccountId: accountId, Url: url, Secret: secret}
+	err := conn(c, r.db).QueryRow(c, fmt.Sprintf(`
+		insert into %s(fk_account_id, url, secret)
+		values ($1, $2, $3)
+		returning id, created_at
+	`, model.WebhooksTable), accountId, url, secret).Scan(&w.Id, &w.CreatedAt)
+	return w, err
+}
+
+func (r webhookPostgresRepo) FindByAccount(c context.Context, accountId uint) ([]model.Webhook, error) {
+	rows, err := conn(c, r.db).Query(c, fmt.Sprintf(`
+		select id, fk_account_id, url, created_at
+		from %s
+		where fk_account_id = $1 and deleted_at is null
+		order by id
+	`, model.WebhooksTable), accountId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []model.Webhook{}
+	for rows.Next() {
+		var w model.Webhook
+		if err := rows.Scan(&w.Id, &w.AccountId, &w.Url, &w.CreatedAt); err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, w)
+	}
+	return webhooks, rows.Err()
+}
+
+func (r webhookPostgresRepo) DeleteOne(c context.Context, accountId, webhookId uint) error {
+	tag, err := conn(c, r.db).Exec(c, fmt.Sprintf(`
+		update %s
+		set deleted_at = current_timestamp
+		where id = $1 and fk_account_id = $2 and deleted_at is null
+	`, model.WebhooksTable), webhookId, accountId)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+func (r webhookPostgresRepo) FindDeliveries(c context.Context, accountId uint, status model.DeliveryStatus) ([]model.WebhookDelivery, error) {
+	rows, err := conn(c, r.db).Query(c, fmt.Sprintf(`
+		select %s
+		from %s d
+		join %s w on w.id = d.fk_webhook_id
+		where w.fk_account_id = $1 and ($2 = '' or d.status = $2)
+		order by d.id
+	`, deliveryColumns, model.WebhookDeliveriesTable, model.WebhooksTable), accountId, string(status))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []model.WebhookDelivery{}
+	for rows.Next() {
+		var d model.WebhookDelivery
+		if err := scanDelivery(rows, &d); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+func (r webhookPostgresRepo) FindDelivery(c context.Context, accountId, deliveryId uint) (model.WebhookDelivery, error) {
+	var d model.WebhookDelivery
+	err := scanDelivery(conn(c, r.db).QueryRow(c, fmt.Sprintf(`
+		select %s
+		from %s d
+		join %s w on w.id = d.fk_webhook_id
+		where d.id = $1 and w.fk_account_id = $2
+	`, deliveryColumns, model.WebhookDeliveriesTable, model.WebhooksTable), deliveryId, accountId), &d)
+	if err != nil {
+		return d, err
+	}
+
+	rows, err := conn(c, r.db).Query(c, fmt.Sprintf(`
+		select attempt, coalesce(response_code, 0), coalesce(error, ''), delivered, next_attempt_at, created_at
+		from %s
+		where fk_delivery_id = $1
+		order by id
+	`, model.WebhookAttemptsTable), deliveryId)
+	if err != nil {
+		return d, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a model.WebhookAttempt
+		if err := rows.Scan(&a.Attempt, &a.ResponseCode, &a.Error, &a.Delivered, &a.NextAttemptAt, &a.CreatedAt); err != nil {
+			return d, err
+		}
+		d.Log = append(d.Log, a)
+	}
+	return d, rows.Err()
+}
+
+func (r webhookPostgresRepo) Redeliver(c context.Context, accountId, deliveryId uint) (model.WebhookDelivery, error) {
+	tag, err := conn(c, r.db).Exec(c, fmt.Sprintf(`
+		update %s d
+		set status = $1,
+			next_attempt_at = current_timestamp
+		from %s w
+		where d.id = $2
+			and d.status = $3
+			and w.id = d.fk_webhook_id
+			and w.fk_account_id = $4
+	`, model.WebhookDeliveriesTable, model.WebhooksTable), model.DeliveryPending, deliveryId, model.DeliveryFailed, accountId)
+	if err != nil {
+		return model.WebhookDelivery{}, err
+	}
+	if tag.RowsAffected() == 0 {
+		return model.WebhookDelivery{}, pgx.ErrNoRows
+	}
+	return r.FindDelivery(c, accountId, deliveryId)
+}
+
+func (r webhookPostgresRepo) Deliver(c context.Context, limit int, lease time.Duration, deliver func(model.WebhookDelivery) model.WebhookAttempt) (int, error) {
+	deliveries, err := r.claim(c, limit, lease)
+	if err != nil {
+		return 0, err
+	}
+
+	// the requests are sent outside of any database transaction, so slow receivers hold no locks and connections
+	for _, d := range deliveries {
+		if err := r.record(c, d, deliver(d)); err != nil {
+			return 0, err
+		}
+	}
+	return len(deliveries), nil
+}
+
+// claim locks up to limit due deliveries and postpones them by the lease, so they are not attempted by other
+// instances while they are sent. A claimed delivery is attempted again after the lease if the attempt is not recorded.
+func (r webhookPostgresRepo) claim(c context.Context, limit int, lease time.Duration) ([]model.WebhookDelivery, error) {
+	tx, err := conn(c, r.db).Begin(c)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(c)
+
+	// skip locked lets several service instances claim deliveries at once
+	rows, err := tx.Query(c, fmt.Sprintf(`
+		with due as (
+			select d.id
+			from %[1]s d
+			join %[2]s w on w.id = d.fk_webhook_id
+			where d.status = $1
+				and d.next_attempt_at <= current_timestamp
+				and w.deleted_at is null
+			order by d.next_attempt_at, d.id
+			limit $2
+			for update of d skip locked
+		), claimed as (
+			update %[1]s d
+			set next_attempt_at = current_timestamp + make_interval(secs => $3)
+			from due
+			where d.id = due.id
+			returning d.*
+		)
+		select %[3]s
+		from claimed d
+		join %[2]s w on w.id = d.fk_webhook_id
+		order by d.id
+	`, model.WebhookDeliveriesTable, model.WebhooksTable, deliveryColumns), model.DeliveryPending, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+
+	var deliveries []model.WebhookDelivery
+	for rows.Next() {
+		var d model.WebhookDelivery
+		if err := scanDelivery(rows, &d); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return deliveries, tx.Commit(c)
+}
+
+// record logs the attempt of the claimed delivery and sets the delivery status by it.
+// The attempt is dropped if the delivery was attempted by another instance after the lease.
+func (r webhookPostgresRepo) record(c context.Context, d model.WebhookDelivery, a model.WebhookAttempt) error {
+	tx, err := conn(c, r.db).Begin(c)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(c)
+
+	status := model.DeliveryPending
+	switch {
+	case a.Delivered:
+		status = model.DeliveryDelivered
+	case a.NextAttemptAt == nil:
+		status = model.DeliveryFailed
+	}
+	tag, err := tx.Exec(c, fmt.Sprintf(`
+		update %s
+		set status = $1,
+			attempts = attempts+1,
+			next_attempt_at = $2,
+			last_error = $3,
+			delivered_at = case when $4 then current_timestamp end
+		where id = $5 and attempts = $6 and status = $7
+	`, model.WebhookDeliveriesTable), status, a.NextAttemptAt, nullableString(a.Error), a.Delivered, d.Id, d.Attempts, model.DeliveryPending)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		slog.Warn("webhook attempt is already recorded", slog.Uint64("deliveryId", uint64(d.Id)), slog.Int("attempt", a.Attempt))
+		return nil
+	}
+	if _, err := tx.Exec(c, fmt.Sprintf(`
+		insert into %s(fk_delivery_id, attempt, response_code, error, delivered, next_attempt_at)
+		values ($1, $2, $3, $4, $5, $6)
+	`, model.WebhookAttemptsTable), d.Id, a.Attempt, nullableId(uint(a.ResponseCode)), nullableString(a.Error), a.Delivered, a.NextAttemptAt); err != nil {
+		return err
+	}
+	return tx.Commit(c)
+}
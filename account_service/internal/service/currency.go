@@ -1,58 +1,99 @@
 package service
 
 import (
+	"context"
+
 	"accountservice/internal/errs"
-	"crypto/tls"
-	"encoding/json"
-	"io"
-	"math"
-	"net/http"
+	"accountservice/internal/model"
+	"accountservice/internal/money"
 )
 
-type currencyRate struct {
-	Valute map[string]struct {
-		CharCode string  `json:"CharCode"`
-		Nominal  int     `json:"Nominal"`
-		Value    float64 `json:"Value"`
-	} `json:"Valute"`
-}
+// BaseCurrency is the currency of the exchange rates
+const BaseCurrency = "RUB"
+
+// rateScale is the number of decimal places of the stored cross rates.
+const rateScale = 10
 
-func Convert(currency string, amount float64) (float64, error) {
-	if currency == "RUB" {
-		return amount, nil
+var one = money.New(1, 0)
+
+// rate returns the rate of the currency to rubles, the base currency rate is 1.
+func rate(rates map[string]model.Rate, currency string) (model.Rate, error) {
+	if currency == BaseCurrency {
+		return model.Rate{Currency: BaseCurrency, Value: one, Nominal: one}, nil
+	}
+	r, ok := rates[currency]
+	if !ok {
+		return r, errs.ErrUnsupportedCurrency
+	}
+	if r.Value.Sign() <= 0 || r.Nominal.Sign() <= 0 {
+		return r, errs.ErrCurrencyServiceUnavailable
 	}
+	return r, nil
+}
 
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+// Exchange converts amount between two currencies through the ruble rates. The applied cross rate
+// is rounded to rateScale places and the result to the minor units of the target currency,
+// so the converted amount can be reproduced from the returned rate.
+func Exchange(ctx context.Context, provider RateProvider, from, to string, amount money.Amount) (model.FX, error) {
+	if from == to {
+		rate := one
+		return model.FX{ConvertedAmount: amount, Rate: &rate}, nil
 	}
-	client := &http.Client{Transport: tr}
 
-	resp, err := client.Get("https://www.cbr-xml-daily.ru/daily_json.js")
+	rates, err := provider.Rates(ctx)
 	if err != nil {
-		return amount, err
+		return model.FX{}, err
 	}
-	defer resp.Body.Close()
 
-	raw, err := io.ReadAll(resp.Body)
+	fromRate, err := rate(rates, from)
 	if err != nil {
-		return amount, err
+		return model.FX{}, err
+	}
+	toRate, err := rate(rates, to)
+	if err != nil {
+		return model.FX{}, err
 	}
 
-	rates := currencyRate{}
-	if err := json.Unmarshal(raw, &rates); err != nil {
-		return amount, err
+	// (fromValue/fromNominal) / (toValue/toNominal)
+	cross := fromRate.Value.Mul(toRate.Nominal).Quo(fromRate.Nominal.Mul(toRate.Value), rateScale)
+	fx := model.FX{
+		ConvertedAmount: amount.Mul(cross).RoundTo(to),
+		Rate:            &cross,
+		RateSource:      fromRate.Source,
+	}
+	if from == BaseCurrency {
+		fx.RateSource = toRate.Source
 	}
 
-	for _, rate := range rates.Valute {
-		if rate.CharCode == currency {
-			if rate.Nominal == 0 {
-				return amount, errs.ErrCurrencyServiceUnavailable
-			}
-			// TODO: подумать, как правильно округлять валюту
-			convertedAmount := amount * (rate.Value / float64(rate.Nominal))
-			return math.Round(convertedAmount), nil
-		}
+	// the cross rate is valid since the later of its two legs
+	validFrom := fromRate.ValidFrom
+	if toRate.ValidFrom.After(validFrom) {
+		validFrom = toRate.ValidFrom
+	}
+	if !validFrom.IsZero() {
+		fx.RateValidFrom = &validFrom
 	}
+	return fx, nil
+}
 
-	return amount, errs.ErrUnsupportedCurrency
+// Convert returns the amount converted by Exchange.
+func Convert(ctx context.Context, provider RateProvider, from, to string, amount money.Amount) (money.Amount, error) {
+	fx, err := Exchange(ctx, provider, from, to, amount)
+	if err != nil {
+		return amount, err
+	}
+	return fx.ConvertedAmount, nil
+}
+
+// CheckCurrency returns ErrUnsupportedCurrency if there is no rate for the currency.
+func CheckCurrency(ctx context.Context, provider RateProvider, currency string) error {
+	if currency == BaseCurrency {
+		return nil
+	}
+	rates, err := provider.Rates(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = rate(rates, currency)
+	return err
 }
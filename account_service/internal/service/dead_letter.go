@@ -0,0 +1,133 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"accountservice/internal/errs"
+	"accountservice/internal/model"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// The processor publishes the transactions it gives up on to deadLetterExchange,
+// the number of attempts and the last error are passed in headers.
+const (
+	deadLetterExchange = "process_transaction.dlx"
+	deadLetterQueue    = "process_transaction.dead"
+	attemptHeader      = "x-attempt"
+	errorHeader        = "x-error"
+)
+
+// DeadLetterConsumer receives the transactions the processor gave up on.
+type DeadLetterConsumer interface {
+	// ConsumeDeadLetters passes the dead-lettered transactions to handle.
+	ConsumeDeadLetters(handle func(model.DeadLetter) error) error
+}
+
+// ConsumeDeadLetters passes the dead-lettered transactions to handle,
+// a message is acknowledged when handle succeeds or the transaction does not exist and requeued otherwise.
+func (p *TransactionClient) ConsumeDeadLetters(handle func(model.DeadLetter) error) error {
+	p.connMu.Lock()
+	defer p.connMu.Unlock()
+
+	p.deadLetters = handle
+	msgs, err := p.consumeDeadLetters(p.ch)
+	if err != nil {
+		return err
+	}
+	go p.dispatchDeadLetters(msgs)
+	return nil
+}
+
+func (p *TransactionClient) consumeDeadLetters(ch *amqp.Channel) (<-chan amqp.Delivery, error) {
+	if err := ch.ExchangeDeclare(
+		deadLetterExchange,
+		"fanout",
+		true,  // durable
+		false, // auto delete
+		false, // internal
+		false, // no wait
+		nil,
+	); err != nil {
+		return nil, fmt.Errorf("declare dead letter exchange: %w", err)
+	}
+	if _, err := ch.QueueDeclare(
+		deadLetterQueue,
+		true,  // durable
+		false, // auto delete
+		false, // exclusive
+		false, // no wait
+		nil,
+	); err != nil {
+		return nil, fmt.Errorf("declare dead letter queue: %w", err)
+	}
+	if err := ch.QueueBind(deadLetterQueue, "", deadLetterExchange, false, nil); err != nil {
+		return nil, fmt.Errorf("bind dead letter queue: %w", err)
+	}
+	return ch.Consume(
+		deadLetterQueue,
+		"",
+		false, // auto ack
+		false, // exclusive
+		false, // no local
+		false, // no wait
+		nil,
+	)
+}
+
+func (p *TransactionClient) dispatchDeadLetters(msgs <-chan amqp.Delivery) {
+	for d := range msgs {
+		deadLetter, err := parseDeadLetter(d)
+		if err != nil {
+			// nothing can be redriven without the transaction id
+			slog.Error("malformed dead letter is dropped", slog.String("body", string(d.Body)), slog.Any("error", err))
+			_ = d.Ack(false)
+			continue
+		}
+
+		err = p.deadLetters(deadLetter)
+		if errors.Is(err, errs.ErrUnknownTransaction) {
+			// storing it fails on every delivery, like a malformed body
+			slog.Error("dead letter of unknown transaction is dropped", slog.Uint64("transactionId", uint64(deadLetter.TransactionId)), slog.Any("error", err))
+			_ = d.Ack(false)
+			continue
+		}
+		if err != nil {
+			slog.Error("failed to store dead letter", slog.Uint64("transactionId", uint64(deadLetter.TransactionId)), slog.Any("error", err))
+			// do not spin on the same message while the storage is down
+			time.Sleep(time.Second)
+			_ = d.Nack(false, true)
+			continue
+		}
+		_ = d.Ack(false)
+	}
+	slog.Debug("dead letter consumer stopped")
+}
+
+func parseDeadLetter(d amqp.Delivery) (model.DeadLetter, error) {
+	transactionId, err := strconv.ParseUint(string(d.Body), 10, 64)
+	if err != nil {
+		return model.DeadLetter{}, err
+	}
+
+	reason, _ := d.Headers[errorHeader].(string)
+	if reason == "" {
+		reason = "unknown"
+	}
+
+	var attempts int
+	switch v := d.Headers[attemptHeader].(type) {
+	case int32:
+		attempts = int(v)
+	case int64:
+		attempts = int(v)
+	case int:
+		attempts = v
+	}
+
+	return model.DeadLetter{TransactionId: uint(transactionId), Reason: reason, Attempts: attempts}, nil
+}
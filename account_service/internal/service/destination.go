@@ -0,0 +1,192 @@
+package service
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"accountservice/internal/model"
+
+	"golang.org/x/crypto/sha3"
+)
+
+type cardScheme struct {
+	name     string
+	from, to int // inclusive BIN prefix range, compared by the number of digits in from
+	lengths  []int
+}
+
+// order matters, narrower ranges go before wider ones
+var cardSchemes = []cardScheme{
+	{"Mir", 2200, 2204, []int{16, 17, 18, 19}},
+	{"Mastercard", 2221, 2720, []int{16}},
+	{"Mastercard", 51, 55, []int{16}},
+	{"Visa", 4, 4, []int{13, 16, 19}},
+	{"American Express", 34, 34, []int{15}},
+	{"American Express", 37, 37, []int{15}},
+	{"JCB", 3528, 3589, []int{16, 17, 18, 19}},
+	{"UnionPay", 62, 62, []int{16, 17, 18, 19}},
+	{"Maestro", 50, 50, []int{12, 13, 14, 15, 16, 17, 18, 19}},
+	{"Maestro", 56, 69, []int{12, 13, 14, 15, 16, 17, 18, 19}},
+}
+
+var (
+	digitsRe   = regexp.MustCompile(`^[0-9]+$`)
+	ethereumRe = regexp.MustCompile(`^0x[0-9a-fA-F]{40}$`)
+)
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// ValidateDestination checks the destination number format by its type and returns the normalized destination.
+func ValidateDestination(d model.Destination) (model.Destination, []model.FieldError) {
+	d.Type = model.DestinationType(strings.ToLower(strings.TrimSpace(string(d.Type))))
+	d.Number = strings.TrimSpace(d.Number)
+	if d.Number == "" {
+		return d, []model.FieldError{{Field: "destination.number", Reason: "is required"}}
+	}
+
+	var reason string
+	switch d.Type {
+	case model.Card:
+		d.Number = strings.NewReplacer(" ", "", "-", "").Replace(d.Number)
+		reason = validateCard(d.Number)
+	case model.UsdtTrc20:
+		reason = validateTronAddress(d.Number)
+	case model.UsdtErc20:
+		reason = validateEthereumAddress(d.Number)
+	default:
+		return d, []model.FieldError{{
+			Field:  "destination.type",
+			Reason: fmt.Sprintf("must be one of %q, %q, %q", model.Card, model.UsdtTrc20, model.UsdtErc20),
+		}}
+	}
+
+	if reason != "" {
+		return d, []model.FieldError{{Field: "destination.number", Reason: reason}}
+	}
+	return d, nil
+}
+
+func validateCard(number string) string {
+	if !digitsRe.MatchString(number) {
+		return "card number must contain only digits"
+	}
+
+	scheme, ok := findCardScheme(number)
+	if !ok {
+		return "unsupported card scheme"
+	}
+	if !slices.Contains(scheme.lengths, len(number)) {
+		return fmt.Sprintf("%s card number can't be %d digits long", scheme.name, len(number))
+	}
+	if !luhn(number) {
+		return "card number checksum mismatch"
+	}
+	return ""
+}
+
+func findCardScheme(number string) (cardScheme, bool) {
+	for _, scheme := range cardSchemes {
+		digits := len(strconv.Itoa(scheme.from))
+		if len(number) < digits {
+			continue
+		}
+		prefix, _ := strconv.Atoi(number[:digits])
+		if prefix >= scheme.from && prefix <= scheme.to {
+			return scheme, true
+		}
+	}
+	return cardScheme{}, false
+}
+
+// luhn doubles every second digit from the right, the sum must be divisible by 10.
+func luhn(number string) bool {
+	var sum int
+	double := false
+	for i := len(number) - 1; i >= 0; i-- {
+		digit := int(number[i] - '0')
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// validateTronAddress checks the base58check address with the 0x41 mainnet prefix.
+func validateTronAddress(address string) string {
+	if len(address) != 34 || address[0] != 'T' {
+		return "TRON address must start with T and be 34 characters long"
+	}
+
+	decoded, ok := decodeBase58(address)
+	if !ok || len(decoded) != 25 || decoded[0] != 0x41 {
+		return "TRON address is not valid base58"
+	}
+
+	first := sha256.Sum256(decoded[:21])
+	second := sha256.Sum256(first[:])
+	if !bytes.Equal(second[:4], decoded[21:]) {
+		return "TRON address checksum mismatch"
+	}
+	return ""
+}
+
+func decodeBase58(s string) ([]byte, bool) {
+	n := new(big.Int)
+	radix := big.NewInt(58)
+	for _, r := range s {
+		i := strings.IndexRune(base58Alphabet, r)
+		if i < 0 {
+			return nil, false
+		}
+		n.Mul(n, radix)
+		n.Add(n, big.NewInt(int64(i)))
+	}
+
+	decoded := n.Bytes()
+	// leading '1' characters encode leading zero bytes
+	for _, r := range s {
+		if r != '1' {
+			break
+		}
+		decoded = append([]byte{0}, decoded...)
+	}
+	return decoded, true
+}
+
+// validateEthereumAddress checks the hex address, mixed case addresses must match the EIP-55 checksum.
+func validateEthereumAddress(address string) string {
+	if !ethereumRe.MatchString(address) {
+		return "Ethereum address must be 0x followed by 40 hex characters"
+	}
+
+	hexPart := address[2:]
+	if hexPart == strings.ToLower(hexPart) || hexPart == strings.ToUpper(hexPart) {
+		return ""
+	}
+
+	h := sha3.NewLegacyKeccak256()
+	h.Write([]byte(strings.ToLower(hexPart)))
+	hash := hex.EncodeToString(h.Sum(nil))
+	for i, r := range hexPart {
+		if r >= '0' && r <= '9' {
+			continue
+		}
+		upper := hash[i] >= '8'
+		if upper != (r >= 'A' && r <= 'F') {
+			return "Ethereum address checksum mismatch"
+		}
+	}
+	return ""
+}
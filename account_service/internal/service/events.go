@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"accountservice/internal/model"
+	"accountservice/internal/repo"
+)
+
+// EventPublisher sends domain events to their subscribers.
+type EventPublisher interface {
+	// PublishEvent sends the domain event to the subscribers of its routing key.
+	PublishEvent(ctx context.Context, event model.Event) error
+	// Degraded reports whether the subscribers are unreachable and PublishEvent fails.
+	Degraded() bool
+}
+
+// EventRelay publishes the domain events stored with the changes to the events exchange.
+// Events are published at-least-once and not necessarily in the order of their ids,
+// consumers deduplicate them by id and order them by occurredAt if they need to.
+type EventRelay struct {
+	eventRepo repo.EventRepo
+	publisher EventPublisher
+	interval  time.Duration
+	batchSize int
+}
+
+func NewEventRelay(er repo.EventRepo, publisher EventPublisher, interval time.Duration, batchSize int) EventRelay {
+	return EventRelay{
+		eventRepo: er,
+		publisher: publisher,
+		interval:  interval,
+		batchSize: batchSize,
+	}
+}
+
+func (r EventRelay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if r.publisher.Degraded() {
+			continue
+		}
+
+		for {
+			published, err := r.eventRepo.Relay(ctx, r.batchSize, func(event model.Event) error {
+				err := r.publisher.PublishEvent(ctx, event)
+				if err != nil {
+					slog.Error("failed to publish event", slog.Uint64("eventId", uint64(event.Id)), slog.Any("error", err))
+				}
+				return err
+			})
+			if err != nil {
+				slog.Error("failed to relay events", slog.Any("error", err))
+				break
+			}
+			if published < r.batchSize {
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"accountservice/internal/repo"
+)
+
+// IdempotencyCleanup deletes the expired idempotency keys in batches, so reservations never scan them.
+type IdempotencyCleanup struct {
+	idempotencyRepo repo.IdempotencyRepo
+	interval        time.Duration
+	retention       time.Duration
+	batchSize       int
+}
+
+func NewIdempotencyCleanup(ir repo.IdempotencyRepo, interval, retention time.Duration, batchSize int) IdempotencyCleanup {
+	return IdempotencyCleanup{
+		idempotencyRepo: ir,
+		interval:        interval,
+		retention:       retention,
+		batchSize:       batchSize,
+	}
+}
+
+// Run purges expired keys at start and then every interval until ctx is cancelled.
+func (r IdempotencyCleanup) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		purged := r.purge(ctx)
+		if purged > 0 {
+			slog.Info("purged expired idempotency keys", slog.Int("count", purged))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purge deletes full batches until the expired keys run out.
+func (r IdempotencyCleanup) purge(ctx context.Context) int {
+	total := 0
+	for ctx.Err() == nil {
+		purged, err := r.idempotencyRepo.Purge(ctx, r.retention, r.batchSize)
+		if err != nil {
+			slog.Error("failed to purge expired idempotency keys", slog.Any("error", err))
+			return total
+		}
+		total += purged
+		if purged < r.batchSize {
+			break
+		}
+	}
+	return total
+}
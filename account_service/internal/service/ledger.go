@@ -0,0 +1,64 @@
+package service
+
+import (
+	"accountservice/internal/model"
+	"accountservice/internal/money"
+)
+
+// HoldEntry freezes the transaction amount in the account wallet while the transaction is processed.
+// Invoice funds come from the processor, withdraw funds are taken from the active balance.
+func HoldEntry(t model.Transaction) model.JournalEntry {
+	source := model.Posting{Bucket: model.Settlement, Currency: t.Currency, Amount: t.Amount.Neg()}
+	if t.Operation == model.Withdraw {
+		source = model.Posting{AccountId: t.AccountId, Bucket: model.Available, Currency: t.Currency, Amount: t.Amount.Neg()}
+	}
+
+	return model.JournalEntry{
+		TransactionId: t.Id,
+		Kind:          model.Hold,
+		Postings: []model.Posting{
+			source,
+			{AccountId: t.AccountId, Bucket: model.Frozen, Currency: t.Currency, Amount: t.Amount},
+		},
+	}
+}
+
+// SettleEntry releases the frozen amount according to the final transaction status.
+// Successful invoice and failed withdraw return money to the active balance,
+// otherwise it goes to the processor.
+func SettleEntry(t model.Transaction, status model.Status) model.JournalEntry {
+	target := model.Posting{Bucket: model.Settlement, Currency: t.Currency, Amount: t.Amount}
+	if (t.Operation == model.Invoice && status == model.Success) || (t.Operation == model.Withdraw && status != model.Success) {
+		target = model.Posting{AccountId: t.AccountId, Bucket: model.Available, Currency: t.Currency, Amount: t.Amount}
+	}
+
+	return model.JournalEntry{
+		TransactionId: t.Id,
+		Kind:          model.Settle,
+		Postings: []model.Posting{
+			{AccountId: t.AccountId, Bucket: model.Frozen, Currency: t.Currency, Amount: t.Amount.Neg()},
+			target,
+		},
+	}
+}
+
+// TransferEntry moves the transaction amount from the sender wallet to the receiver wallet.
+// When the credited currency differs, both currency legs are balanced by the exchange account.
+func TransferEntry(t model.Transaction, creditCurrency string, creditAmount money.Amount) model.JournalEntry {
+	postings := []model.Posting{
+		{AccountId: t.AccountId, Bucket: model.Available, Currency: t.Currency, Amount: t.Amount.Neg()},
+	}
+	if creditCurrency != t.Currency {
+		postings = append(postings,
+			model.Posting{Bucket: model.Exchange, Currency: t.Currency, Amount: t.Amount},
+			model.Posting{Bucket: model.Exchange, Currency: creditCurrency, Amount: creditAmount.Neg()},
+		)
+	}
+	postings = append(postings, model.Posting{AccountId: t.CounterpartyId, Bucket: model.Available, Currency: creditCurrency, Amount: creditAmount})
+
+	return model.JournalEntry{
+		TransactionId: t.Id,
+		Kind:          model.Move,
+		Postings:      postings,
+	}
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"accountservice/internal/model"
+	"accountservice/internal/repo"
+)
+
+// OutboxRelay publishes transactions stored in the outbox to the processor.
+// A message is marked as sent only after a successful publish, so delivery is at-least-once.
+type OutboxRelay struct {
+	outboxRepo      repo.OutboxRepo
+	transactionRepo repo.TransactionRepo
+	processor       TransactionProcessor
+	onPublished     func(model.Transaction)
+	interval        time.Duration
+	batchSize       int
+	// lease is the time a batch is claimed for, it must cover the publishes of the whole batch
+	lease time.Duration
+}
+
+func NewOutboxRelay(or repo.OutboxRepo, tr repo.TransactionRepo, processor TransactionProcessor, onPublished func(model.Transaction), interval time.Duration, batchSize int, lease time.Duration) OutboxRelay {
+	return OutboxRelay{
+		outboxRepo:      or,
+		transactionRepo: tr,
+		processor:       processor,
+		onPublished:     onPublished,
+		interval:        interval,
+		batchSize:       batchSize,
+		lease:           lease,
+	}
+}
+
+func (r OutboxRelay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		// the messages stay in the outbox until the broker is back
+		if r.processor.Degraded() {
+			continue
+		}
+
+		// drain the backlog before waiting for the next tick
+		for {
+			sent, err := r.relay(ctx)
+			if err != nil {
+				slog.Error("failed to relay outbox", slog.Any("error", err))
+				break
+			}
+			if sent < r.batchSize {
+				break
+			}
+		}
+	}
+}
+
+// relay publishes a batch, the replies are awaited only for the messages marked as sent,
+// the other ones are published and awaited again.
+func (r OutboxRelay) relay(ctx context.Context) (int, error) {
+	published := make(map[uint]model.Transaction)
+	sent, err := r.outboxRepo.Relay(ctx, r.batchSize, r.lease, func(msg model.OutboxMessage) error {
+		transaction, err := r.transactionRepo.FindOne(ctx, msg.TransactionId)
+		if err != nil {
+			return err
+		}
+		if err := r.processor.Publish(ctx, transaction); err != nil {
+			return err
+		}
+		published[msg.Id] = transaction
+		return nil
+	})
+	for _, msg := range sent {
+		go r.onPublished(published[msg.Id])
+	}
+	return len(sent), err
+}
@@ -0,0 +1,179 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"accountservice/internal/config"
+	"accountservice/internal/errs"
+	"accountservice/internal/model"
+)
+
+const (
+	RabbitProcessorName = "rabbit"
+	MemoryProcessorName = "memory"
+)
+
+// Outcomes of the in-memory processor, timeout never replies and dead dead-letters the transaction.
+const (
+	OutcomeSuccess = "success"
+	OutcomeError   = "error"
+	OutcomeTimeout = "timeout"
+	OutcomeDead    = "dead"
+)
+
+// TransactionProcessor sends transactions to the external processor and awaits its replies.
+type TransactionProcessor interface {
+	// Publish sends the transaction to processing, the reply can be awaited right after it.
+	Publish(ctx context.Context, transaction model.Transaction) error
+	// Await returns the processing result, ErrProcessingTimeout if there is no reply in time.
+	Await(ctx context.Context, transactionId uint) (model.Status, error)
+	// Degraded reports whether the processor is unreachable and Publish fails.
+	Degraded() bool
+}
+
+// Broker is the connection to the processor and the event subscribers, the services use its narrower interfaces.
+type Broker interface {
+	TransactionProcessor
+	EventPublisher
+	DeadLetterConsumer
+	Close()
+}
+
+// MustNewBroker creates the broker of the processor selected by PROCESSOR.
+func MustNewBroker(cfg *config.Config) Broker {
+	switch cfg.Processor.Name {
+	case RabbitProcessorName:
+		return MustNewTransactionClient(cfg).WithQueue("", false, false).WithConsumer("")
+	case MemoryProcessorName:
+		// the reply timeout is shared by the processors
+		processor, err := NewMemoryProcessor(cfg.Processor.Outcome, cfg.Processor.Latency, cfg.Rabbit.ReplyTimeout)
+		if err != nil {
+			panic(err)
+		}
+		return processor
+	default:
+		panic(fmt.Errorf("unknown processor %q", cfg.Processor.Name))
+	}
+}
+
+type memoryProcessor struct {
+	outcome      string
+	latency      time.Duration
+	replyTimeout time.Duration
+
+	mu          sync.Mutex
+	pending     map[uint]chan model.Status
+	deadLetters func(model.DeadLetter) error
+}
+
+// NewMemoryProcessor processes transactions in process with the same outcome after the latency,
+// it is meant for dev runs and tests without RabbitMQ.
+func NewMemoryProcessor(outcome string, latency, replyTimeout time.Duration) (Broker, error) {
+	switch outcome {
+	case OutcomeSuccess, OutcomeError, OutcomeTimeout, OutcomeDead:
+	default:
+		return nil, fmt.Errorf("unknown processor outcome %q", outcome)
+	}
+	return &memoryProcessor{
+		outcome:      outcome,
+		latency:      latency,
+		replyTimeout: replyTimeout,
+		pending:      make(map[uint]chan model.Status),
+	}, nil
+}
+
+func (p *memoryProcessor) reply(id uint) chan model.Status {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	reply, ok := p.pending[id]
+	if !ok {
+		reply = make(chan model.Status, 1)
+		p.pending[id] = reply
+	}
+	return reply
+}
+
+func (p *memoryProcessor) Publish(ctx context.Context, transaction model.Transaction) error {
+	reply := p.reply(transaction.Id)
+	go func() {
+		time.Sleep(p.latency)
+		switch p.outcome {
+		case OutcomeSuccess:
+			send(reply, model.Success)
+		case OutcomeError:
+			send(reply, model.Error)
+		case OutcomeDead:
+			p.deadLetter(transaction.Id)
+		}
+	}()
+	return nil
+}
+
+// send drops the status if the reply already has one, like a duplicate reply of the broker.
+func send(reply chan<- model.Status, status model.Status) {
+	select {
+	case reply <- status:
+	default:
+	}
+}
+
+func (p *memoryProcessor) deadLetter(transactionId uint) {
+	p.mu.Lock()
+	handle := p.deadLetters
+	p.mu.Unlock()
+	if handle == nil {
+		return
+	}
+	if err := handle(model.DeadLetter{TransactionId: transactionId, Reason: "dead outcome", Attempts: 1}); err != nil {
+		slog.Error("failed to store dead letter", slog.Uint64("transactionId", uint64(transactionId)), slog.Any("error", err))
+	}
+}
+
+func (p *memoryProcessor) Await(ctx context.Context, transactionId uint) (model.Status, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.replyTimeout)
+		defer cancel()
+	}
+
+	reply := p.reply(transactionId)
+	defer func() {
+		p.mu.Lock()
+		delete(p.pending, transactionId)
+		p.mu.Unlock()
+	}()
+
+	select {
+	case status := <-reply:
+		return status, nil
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return model.Created, fmt.Errorf("%w: transaction %d", errs.ErrProcessingTimeout, transactionId)
+		}
+		return model.Created, ctx.Err()
+	}
+}
+
+func (p *memoryProcessor) Degraded() bool {
+	return false
+}
+
+func (p *memoryProcessor) ConsumeDeadLetters(handle func(model.DeadLetter) error) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.deadLetters = handle
+	return nil
+}
+
+// PublishEvent drops the event, there are no subscribers without a broker.
+func (p *memoryProcessor) PublishEvent(ctx context.Context, event model.Event) error {
+	slog.Debug("event", slog.String("routingKey", event.RoutingKey), slog.String("data", string(event.Data)))
+	return nil
+}
+
+func (p *memoryProcessor) Close() {}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"accountservice/internal/errs"
+	"accountservice/internal/model"
+	"accountservice/internal/repo"
+)
+
+// RateRefresher saves the rates of the upstream provider on a schedule,
+// conversions read them through the store provider.
+type RateRefresher struct {
+	provider RateProvider
+	rateRepo repo.RateRepo
+	interval time.Duration
+}
+
+func NewRateRefresher(provider RateProvider, rr repo.RateRepo, interval time.Duration) RateRefresher {
+	return RateRefresher{
+		provider: provider,
+		rateRepo: rr,
+		interval: interval,
+	}
+}
+
+// Run refreshes the rates at start and then every interval until ctx is cancelled.
+func (r RateRefresher) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.Refresh(ctx); err != nil {
+			slog.Error("failed to refresh rates", slog.String("provider", r.provider.Name()), slog.Any("error", err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh stores the current rates of the provider. The fixture rates a failover chain falls back to
+// are not stored, they would replace the real ones for the conversions; only a fixture-only provider stores them.
+func (r RateRefresher) Refresh(ctx context.Context) error {
+	rates, err := r.provider.Rates(ctx)
+	if err != nil {
+		return err
+	}
+
+	list := make([]model.Rate, 0, len(rates))
+	for _, rate := range rates {
+		if rate.Source == FixtureProviderName && r.provider.Name() != FixtureProviderName {
+			return fmt.Errorf("%w: fixture rates are not stored, the latest stored rates are kept", errs.ErrCurrencyServiceUnavailable)
+		}
+		list = append(list, rate)
+	}
+	changed, err := r.rateRepo.InsertMany(ctx, list)
+	if err != nil {
+		return err
+	}
+	slog.Debug("rates refreshed", slog.Int("received", len(list)), slog.Int("changed", changed))
+	return nil
+}
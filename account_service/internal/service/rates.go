@@ -0,0 +1,213 @@
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"accountservice/internal/config"
+	"accountservice/internal/errs"
+	"accountservice/internal/model"
+	"accountservice/internal/money"
+	"accountservice/internal/repo"
+)
+
+const (
+	CBRProviderName     = "cbr"
+	FixtureProviderName = "fixture"
+	StoreProviderName   = "store"
+)
+
+// RateProvider is a source of exchange rates to BaseCurrency.
+type RateProvider interface {
+	Name() string
+	// Rates returns the current rates by currency code, BaseCurrency is not included.
+	Rates(ctx context.Context) (map[string]model.Rate, error)
+}
+
+// NewRateProvider creates the providers listed in RATES_PROVIDER,
+// several comma separated providers are combined into a failover chain.
+func NewRateProvider(cfg *config.Config) (RateProvider, error) {
+	var providers []RateProvider
+	for _, name := range strings.Split(cfg.Rates.Provider, ",") {
+		switch strings.TrimSpace(name) {
+		case CBRProviderName:
+			providers = append(providers, NewCBRProvider(cfg.Rates.CBRUrl, cfg.Rates.Timeout))
+		case FixtureProviderName:
+			provider, err := NewFixtureProvider(cfg.Rates.FixturePath)
+			if err != nil {
+				return nil, err
+			}
+			providers = append(providers, provider)
+		default:
+			return nil, fmt.Errorf("unknown rate provider %q", name)
+		}
+	}
+	if len(providers) == 1 {
+		return providers[0], nil
+	}
+	return NewCompositeProvider(providers...), nil
+}
+
+// cbrRates is the daily_json.js format of the CBR rates.
+type cbrRates struct {
+	Valute map[string]struct {
+		CharCode string       `json:"CharCode"`
+		Nominal  int64        `json:"Nominal"`
+		Value    money.Amount `json:"Value"`
+	} `json:"Valute"`
+}
+
+func (r cbrRates) rates(source string) map[string]model.Rate {
+	rates := make(map[string]model.Rate, len(r.Valute))
+	for _, v := range r.Valute {
+		rates[v.CharCode] = model.Rate{Currency: v.CharCode, Value: v.Value, Nominal: money.New(v.Nominal, 0), Source: source}
+	}
+	return rates
+}
+
+type cbrProvider struct {
+	url    string
+	client *http.Client
+}
+
+// NewCBRProvider downloads the rates from the CBR daily JSON on every call.
+func NewCBRProvider(url string, timeout time.Duration) RateProvider {
+	return cbrProvider{
+		url: url,
+		client: &http.Client{
+			Timeout: timeout,
+			// the prod image has no CA certificates
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+		},
+	}
+}
+
+func (p cbrProvider) Name() string {
+	return CBRProviderName
+}
+
+func (p cbrProvider) Rates(ctx context.Context) (map[string]model.Rate, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errs.ErrCurrencyServiceUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: status %d", errs.ErrCurrencyServiceUnavailable, resp.StatusCode)
+	}
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errs.ErrCurrencyServiceUnavailable, err)
+	}
+
+	var rates cbrRates
+	if err := json.Unmarshal(raw, &rates); err != nil {
+		return nil, fmt.Errorf("%w: %w", errs.ErrCurrencyServiceUnavailable, err)
+	}
+	return rates.rates(CBRProviderName), nil
+}
+
+type fixtureProvider struct {
+	rates map[string]model.Rate
+}
+
+// NewFixtureProvider reads static rates from a file in the CBR daily JSON format once,
+// it is meant for offline runs and tests.
+func NewFixtureProvider(path string) (RateProvider, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rates cbrRates
+	if err := json.Unmarshal(raw, &rates); err != nil {
+		return nil, fmt.Errorf("failed to parse rates fixture %s: %w", path, err)
+	}
+	return fixtureProvider{rates.rates(FixtureProviderName)}, nil
+}
+
+func (p fixtureProvider) Name() string {
+	return FixtureProviderName
+}
+
+func (p fixtureProvider) Rates(ctx context.Context) (map[string]model.Rate, error) {
+	rates := make(map[string]model.Rate, len(p.rates))
+	for currency, rate := range p.rates {
+		rates[currency] = rate
+	}
+	return rates, nil
+}
+
+type compositeProvider struct {
+	providers []RateProvider
+}
+
+// NewCompositeProvider returns the rates of the first provider that succeeds.
+func NewCompositeProvider(providers ...RateProvider) RateProvider {
+	return compositeProvider{providers}
+}
+
+func (p compositeProvider) Name() string {
+	names := make([]string, len(p.providers))
+	for i, provider := range p.providers {
+		names[i] = provider.Name()
+	}
+	return strings.Join(names, ",")
+}
+
+func (p compositeProvider) Rates(ctx context.Context) (map[string]model.Rate, error) {
+	var failures []error
+	for _, provider := range p.providers {
+		rates, err := provider.Rates(ctx)
+		if err == nil {
+			return rates, nil
+		}
+		failures = append(failures, fmt.Errorf("%s: %w", provider.Name(), err))
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, errors.Join(failures...)
+}
+
+type storeProvider struct {
+	rateRepo repo.RateRepo
+}
+
+// NewStoreProvider serves the latest rates saved by the RateRefresher.
+func NewStoreProvider(rr repo.RateRepo) RateProvider {
+	return storeProvider{rr}
+}
+
+func (p storeProvider) Name() string {
+	return StoreProviderName
+}
+
+func (p storeProvider) Rates(ctx context.Context) (map[string]model.Rate, error) {
+	latest, err := p.rateRepo.FindLatest(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errs.ErrCurrencyServiceUnavailable, err)
+	}
+	if len(latest) == 0 {
+		return nil, fmt.Errorf("%w: rates are not loaded yet", errs.ErrCurrencyServiceUnavailable)
+	}
+
+	rates := make(map[string]model.Rate, len(latest))
+	for _, rate := range latest {
+		rates[rate.Currency] = rate
+	}
+	return rates, nil
+}
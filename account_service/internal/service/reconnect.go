@@ -0,0 +1,74 @@
+package service
+
+import (
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+// Reconnector restores a lost connection, the connection is degraded until connect succeeds.
+type Reconnector struct {
+	connect    func() error
+	resume     func()
+	baseDelay  time.Duration
+	maxBackoff time.Duration
+
+	degraded atomic.Bool
+	closed   atomic.Bool
+}
+
+// NewReconnector retries connect with the delay doubling from baseDelay up to maxBackoff
+// and calls resume once the connection is restored.
+func NewReconnector(connect func() error, resume func(), baseDelay, maxBackoff time.Duration) *Reconnector {
+	return &Reconnector{
+		connect:    connect,
+		resume:     resume,
+		baseDelay:  baseDelay,
+		maxBackoff: maxBackoff,
+	}
+}
+
+// Backoff returns the delay before the attempt, starting from 1: base, 2*base, 4*base and so on up to limit.
+func Backoff(base, limit time.Duration, attempt int) time.Duration {
+	// the shift is bounded, so the delay can't overflow
+	delay := base << min(max(attempt-1, 0), 20)
+	if delay <= 0 || delay > limit {
+		return limit
+	}
+	return delay
+}
+
+// Degraded reports whether the connection is being restored.
+func (r *Reconnector) Degraded() bool {
+	return r.degraded.Load()
+}
+
+// Closed reports whether Close was called, a closed connection is not restored.
+func (r *Reconnector) Closed() bool {
+	return r.closed.Load()
+}
+
+func (r *Reconnector) Close() {
+	r.closed.Store(true)
+}
+
+// Reconnect blocks until the connection is restored or the reconnector is closed,
+// it reports whether the connection was restored.
+func (r *Reconnector) Reconnect() bool {
+	r.degraded.Store(true)
+	for attempt := 1; !r.closed.Load(); attempt++ {
+		backoff := Backoff(r.baseDelay, r.maxBackoff, attempt)
+		time.Sleep(backoff)
+		if r.closed.Load() {
+			break
+		}
+		err := r.connect()
+		if err == nil {
+			r.degraded.Store(false)
+			r.resume()
+			return true
+		}
+		slog.Error("reconnect", slog.Int("attempt", attempt), slog.Duration("backoff", backoff), slog.Any("error", err))
+	}
+	return false
+}
@@ -0,0 +1,46 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"accountservice/internal/repo"
+)
+
+// Recovery requeues created transactions whose processor reply was lost, for example on restart.
+// The relay publishes them again and the settler finalizes them exactly once.
+type Recovery struct {
+	outboxRepo repo.OutboxRepo
+	interval   time.Duration
+	threshold  time.Duration
+}
+
+func NewRecovery(or repo.OutboxRepo, interval, threshold time.Duration) Recovery {
+	return Recovery{
+		outboxRepo: or,
+		interval:   interval,
+		threshold:  threshold,
+	}
+}
+
+// Run requeues stuck transactions at start and then every interval until ctx is cancelled.
+func (r Recovery) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		requeued, err := r.outboxRepo.Requeue(ctx, r.threshold)
+		if err != nil {
+			slog.Error("failed to requeue stuck transactions", slog.Any("error", err))
+		} else if requeued > 0 {
+			slog.Info("requeued stuck transactions", slog.Int("count", requeued))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
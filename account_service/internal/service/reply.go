@@ -0,0 +1,136 @@
+package service
+
+import (
+	"accountservice/internal/errs"
+	"accountservice/internal/model"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// ReplyRouter passes the processor replies from a shared reply queue to the waiters of their correlation ids,
+// so concurrent transactions never take each other's replies.
+type ReplyRouter struct {
+	// timeout limits Await calls without a deadline
+	timeout time.Duration
+
+	mu      sync.Mutex
+	pending map[string]*call
+}
+
+// call is an in-flight request, published calls are published again after reconnect.
+type call struct {
+	transaction *model.Transaction
+	reply       chan amqp.Delivery
+}
+
+func NewReplyRouter(timeout time.Duration) *ReplyRouter {
+	return &ReplyRouter{
+		timeout: timeout,
+		pending: make(map[string]*call),
+	}
+}
+
+// Dispatch is the only reader of the reply queue, it returns when msgs is closed.
+// Replies without a waiter, like the late ones, are dropped.
+func (r *ReplyRouter) Dispatch(msgs <-chan amqp.Delivery) {
+	for d := range msgs {
+		r.mu.Lock()
+		c, ok := r.pending[d.CorrelationId]
+		r.mu.Unlock()
+		if !ok {
+			slog.Warn("reply without waiter", slog.String("correlationId", d.CorrelationId))
+			continue
+		}
+		// the reply channel is buffered and gets at most one reply
+		select {
+		case c.reply <- d:
+		default:
+		}
+	}
+	slog.Debug("reply consumer stopped")
+}
+
+// Expect registers the waiter of the transaction before it is published, so a fast reply is not lost before Await.
+func (r *ReplyRouter) Expect(transaction model.Transaction) {
+	r.register(correlationId(transaction.Id), &transaction)
+}
+
+// Forget drops the waiter of a transaction that failed to publish.
+func (r *ReplyRouter) Forget(transactionId uint) {
+	r.unregister(correlationId(transactionId))
+}
+
+// Pending returns the published transactions that are still awaited.
+func (r *ReplyRouter) Pending() []model.Transaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var transactions []model.Transaction
+	for _, c := range r.pending {
+		if c.transaction != nil {
+			transactions = append(transactions, *c.transaction)
+		}
+	}
+	return transactions
+}
+
+// Await waits for the reply to the transaction.
+// It returns ErrProcessingTimeout if there is no reply before the ctx deadline or the router timeout.
+func (r *ReplyRouter) Await(ctx context.Context, transactionId uint) (model.Status, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+	}
+
+	id := correlationId(transactionId)
+	c := r.register(id, nil)
+	defer r.unregister(id)
+
+	select {
+	case d := <-c.reply:
+		result, err := strconv.Atoi(string(d.Body))
+		if err != nil {
+			return model.Error, fmt.Errorf("invalid reply %q: %w", d.Body, err)
+		}
+		return model.Status(result), nil
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return model.Created, fmt.Errorf("%w: transaction %s", errs.ErrProcessingTimeout, id)
+		}
+		return model.Created, ctx.Err()
+	}
+}
+
+// register returns the call of the correlation id, creating it if needed.
+// The transaction is kept to publish it again after reconnect, nil keeps the already registered one.
+func (r *ReplyRouter) register(id string, transaction *model.Transaction) *call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.pending[id]
+	if !ok {
+		c = &call{reply: make(chan amqp.Delivery, 1)}
+		r.pending[id] = c
+	}
+	if transaction != nil {
+		c.transaction = transaction
+	}
+	return c
+}
+
+func (r *ReplyRouter) unregister(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.pending, id)
+}
+
+// correlationId is the transaction id, it is also the body of the request.
+func correlationId(transactionId uint) string {
+	return strconv.FormatUint(uint64(transactionId), 10)
+}
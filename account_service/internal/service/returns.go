@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// returnRouter is the only reader of the messages returned on one channel. The library sends returns
+// from the connection reader, so they are always read at once and the reader never blocks on them.
+type returnRouter struct {
+	collect chan returnRequest
+	// done is closed when the channel is closed
+	done chan struct{}
+}
+
+type returnRequest struct {
+	correlationId string
+	result        chan *amqp.Return
+}
+
+func newReturnRouter(returns <-chan amqp.Return) *returnRouter {
+	r := &returnRouter{
+		collect: make(chan returnRequest),
+		done:    make(chan struct{}),
+	}
+	go r.run(returns)
+	return r
+}
+
+func (r *returnRouter) run(returns <-chan amqp.Return) {
+	defer close(r.done)
+
+	// publishes are serialized, so only the latest return can belong to the publish being confirmed
+	var last *amqp.Return
+	keep := func(ret amqp.Return) {
+		if last != nil {
+			slog.Warn("stale returned message", slog.String("correlationId", last.CorrelationId))
+		}
+		last = &ret
+	}
+
+	for {
+		select {
+		case ret, ok := <-returns:
+			if !ok {
+				return
+			}
+			keep(ret)
+		case req := <-r.collect:
+			// the return is sent before the confirmation of the same publish,
+			// so after the confirmation it is either kept already or waiting in returns
+		drain:
+			for {
+				select {
+				case ret, ok := <-returns:
+					if !ok {
+						break drain
+					}
+					keep(ret)
+				default:
+					break drain
+				}
+			}
+			if last != nil && last.CorrelationId == req.correlationId {
+				req.result <- last
+				last = nil
+				continue
+			}
+			req.result <- nil
+		}
+	}
+}
+
+// Collect returns the message with the correlation id if the broker returned it,
+// it must be called after the publish is confirmed.
+func (r *returnRouter) Collect(ctx context.Context, correlationId string) *amqp.Return {
+	req := returnRequest{correlationId: correlationId, result: make(chan *amqp.Return, 1)}
+	select {
+	case r.collect <- req:
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return nil
+	}
+	select {
+	case ret := <-req.result:
+		return ret
+	case <-r.done:
+		return nil
+	}
+}
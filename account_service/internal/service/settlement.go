@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+
+	"accountservice/internal/errs"
+	"accountservice/internal/model"
+	"accountservice/internal/repo"
+)
+
+// Settler finalizes published transactions when the processor replies.
+type Settler struct {
+	processor       TransactionProcessor
+	uow             repo.UnitOfWork
+	accountRepo     repo.AccountRepo
+	transactionRepo repo.TransactionRepo
+	// ids of transactions awaited by this instance, a requeued transaction is awaited once
+	inFlight sync.Map
+}
+
+func NewSettler(processor TransactionProcessor, uow repo.UnitOfWork, ar repo.AccountRepo, tr repo.TransactionRepo) *Settler {
+	return &Settler{
+		processor:       processor,
+		uow:             uow,
+		accountRepo:     ar,
+		transactionRepo: tr,
+	}
+}
+
+// Await waits for the processor reply, sets the final status and releases the frozen amount.
+func (s *Settler) Await(transaction model.Transaction) {
+	if _, awaited := s.inFlight.LoadOrStore(transaction.Id, struct{}{}); awaited {
+		return
+	}
+	defer s.inFlight.Delete(transaction.Id)
+
+	var (
+		ctx    context.Context = context.Background()
+		status model.Status
+		err    error
+	)
+
+	slog.Debug("processing transaction")
+	status, err = s.processor.Await(ctx, transaction.Id)
+	if errors.Is(err, errs.ErrProcessingTimeout) {
+		// the transaction stays created and is published again by the recovery
+		slog.Warn("transaction is not processed in time", slog.Uint64("transactionId", uint64(transaction.Id)), slog.Any("error", err))
+		return
+	}
+	if err != nil || status == model.Error {
+		slog.Error("failed to process transaction", slog.Any("error", err))
+	} else if err == nil && status == model.Success {
+		slog.Debug("processing successfuly completed")
+	}
+	if status != model.Success && status != model.Error {
+		// only a final status settles the transaction, it stays created and is published again by the recovery
+		slog.Error("processor replied with a non-final status", slog.Uint64("transactionId", uint64(transaction.Id)), slog.Int("status", int(status)))
+		return
+	}
+
+	// the status and the settlement entry are committed together, so the entry is posted exactly once.
+	// A failed commit leaves the transaction created, so it is settled by the recovery.
+	var settled bool
+	err = s.uow.Do(ctx, func(c context.Context) error {
+		finalized, ok, err := s.transactionRepo.Finalize(c, transaction.Id, status)
+		if err != nil || !ok {
+			return err
+		}
+		if _, err := s.accountRepo.Post(c, SettleEntry(finalized, status)); err != nil {
+			return err
+		}
+		settled = true
+		return nil
+	})
+	if err != nil {
+		slog.Error("failed to settle transaction", slog.Uint64("transactionId", uint64(transaction.Id)), slog.Any("error", err))
+		return
+	}
+	if !settled {
+		slog.Debug("transaction is already settled", slog.Uint64("transactionId", uint64(transaction.Id)))
+		return
+	}
+
+	if err := s.accountRepo.Reconcile(ctx, transaction.AccountId); err != nil {
+		slog.Error("account is out of sync with the ledger", slog.Uint64("accountId", uint64(transaction.AccountId)), slog.Any("error", err))
+	}
+}
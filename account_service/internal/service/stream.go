@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"accountservice/internal/model"
+	"accountservice/internal/repo"
+)
+
+const (
+	// streamBuffer is the number of events kept for a slow subscriber, later events are dropped.
+	streamBuffer = 64
+	// replayBatch is the number of stored events read at once on replay
+	replayBatch = 100
+)
+
+// StreamHub passes the events committed by any service instance to the subscribers of their accounts.
+type StreamHub struct {
+	eventRepo repo.EventRepo
+
+	mu          sync.Mutex
+	closed      bool
+	subscribers map[uint]map[chan model.Event]struct{}
+}
+
+func NewStreamHub(er repo.EventRepo) *StreamHub {
+	return &StreamHub{
+		eventRepo:   er,
+		subscribers: make(map[uint]map[chan model.Event]struct{}),
+	}
+}
+
+// Run listens to the events until ctx is cancelled, then the subscriptions are closed.
+func (h *StreamHub) Run(ctx context.Context) {
+	for ctx.Err() == nil {
+		err := h.eventRepo.Listen(ctx, h.broadcast)
+		if ctx.Err() != nil {
+			break
+		}
+		slog.Error("event listener stopped", slog.Any("error", err))
+		time.Sleep(time.Second)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for _, subscribers := range h.subscribers {
+		for events := range subscribers {
+			close(events)
+		}
+	}
+	h.subscribers = nil
+}
+
+// Subscribe returns the channel of the account events, it is closed by unsubscribe or when the hub stops.
+func (h *StreamHub) Subscribe(accountId uint) (<-chan model.Event, func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	events := make(chan model.Event, streamBuffer)
+	if h.closed {
+		close(events)
+		return events, func() {}
+	}
+	if h.subscribers[accountId] == nil {
+		h.subscribers[accountId] = make(map[chan model.Event]struct{})
+	}
+	h.subscribers[accountId][events] = struct{}{}
+
+	unsubscribe := func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if _, ok := h.subscribers[accountId][events]; !ok {
+			return
+		}
+		delete(h.subscribers[accountId], events)
+		if len(h.subscribers[accountId]) == 0 {
+			delete(h.subscribers, accountId)
+		}
+		close(events)
+	}
+	return events, unsubscribe
+}
+
+// Replay passes the stored events of the account after the afterId event to handle in id order,
+// it stops at the first handle error. Subscribe before Replay to not miss the events committed meanwhile,
+// they may come from both. An event committed after the afterId one but with a lower id is not replayed.
+func (h *StreamHub) Replay(ctx context.Context, accountId, afterId uint, handle func(model.Event) error) error {
+	for {
+		events, err := h.eventRepo.FindByAccount(ctx, accountId, afterId, replayBatch)
+		if err != nil {
+			return err
+		}
+		for _, event := range events {
+			if err := handle(event); err != nil {
+				return err
+			}
+			afterId = event.Id
+		}
+		if len(events) < replayBatch {
+			return nil
+		}
+	}
+}
+
+func (h *StreamHub) broadcast(event model.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, accountId := range event.AccountIds() {
+		for events := range h.subscribers[accountId] {
+			select {
+			case events <- event:
+			default:
+				slog.Warn("stream subscriber is too slow, event dropped", slog.Uint64("accountId", uint64(accountId)), slog.Uint64("eventId", uint64(event.Id)))
+			}
+		}
+	}
+}
@@ -2,130 +2,387 @@ package service
 
 import (
 	"accountservice/internal/config"
+	"accountservice/internal/errs"
 	"accountservice/internal/model"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
-	"strconv"
+	"sync"
 	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
+// processQueue is declared by the processor.
+const processQueue = "process_transaction"
+
 type TransactionClient struct {
-	conn  *amqp.Connection
-	ch    *amqp.Channel
-	qName string
-	msgs  <-chan amqp.Delivery
+	url string
+	// confirmTimeout limits waiting for the broker to confirm a publish
+	confirmTimeout time.Duration
+	eventsExchange string
+
+	// publishMu serializes publishes, so a returned message belongs to the publish being confirmed
+	publishMu sync.Mutex
+	// connMu guards the connection, the channel and the queue name, they are replaced on reconnect
+	connMu  sync.RWMutex
+	conn    *amqp.Connection
+	ch      *amqp.Channel
+	returns *returnRouter
+	qName   string
+	queue   *queueOptions
+	// consumer is nil until WithConsumer is called
+	consumer *string
+	// deadLetters is nil until ConsumeDeadLetters is called
+	deadLetters func(model.DeadLetter) error
+
+	reconnector *Reconnector
+	replies     *ReplyRouter
+}
+
+type queueOptions struct {
+	name       string
+	durable    bool
+	autoDelete bool
 }
 
 func MustNewTransactionClient(cfg *config.Config) *TransactionClient {
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 	defer cancel()
 
-	url := fmt.Sprintf(
-		"amqp://%s:%s@%s:%d/",
-		cfg.Rabbit.User,
-		cfg.Rabbit.Password,
-		cfg.Rabbit.Host,
-		cfg.Rabbit.Port,
-	)
+	p := &TransactionClient{
+		url: fmt.Sprintf(
+			"amqp://%s:%s@%s:%d/",
+			cfg.Rabbit.User,
+			cfg.Rabbit.Password,
+			cfg.Rabbit.Host,
+			cfg.Rabbit.Port,
+		),
+		confirmTimeout: cfg.Rabbit.ConfirmTimeout,
+		eventsExchange: cfg.Events.Exchange,
+		replies:        NewReplyRouter(cfg.Rabbit.ReplyTimeout),
+	}
+	p.reconnector = NewReconnector(p.connect, p.resume, time.Second, cfg.Rabbit.ReconnectMaxBackoff)
 
 	for {
 		time.Sleep(time.Second)
 		if ctx.Err() != nil {
 			panic(ctx.Err())
 		}
-		conn, err := amqp.Dial(url)
+		conn, ch, returns, err := p.dial()
 		if err != nil {
 			slog.Error("rabbit conn", slog.Any("error", err))
 			continue
 		}
 
-		ch, err := conn.Channel()
-		if err != nil {
-			slog.Error("channel", slog.Any("error", err))
-			continue
-		}
-
-		return &TransactionClient{
-			conn: conn,
-			ch:   ch,
-		}
+		p.conn, p.ch, p.returns = conn, ch, returns
+		go p.watch(conn, ch)
+		return p
 	}
 }
 
-func (p *TransactionClient) WithQueue(qName string, durable, autoDelete bool) *TransactionClient {
-	q, err := p.ch.QueueDeclare(
-		qName,
-		durable,
-		autoDelete,
-		true,  // exclusive
+// dial opens a channel in confirm mode, unroutable mandatory publishes are collected by the return router.
+func (p *TransactionClient) dial() (*amqp.Connection, *amqp.Channel, *returnRouter, error) {
+	conn, err := amqp.Dial(p.url)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return nil, nil, nil, fmt.Errorf("channel: %w", err)
+	}
+	if err := ch.Confirm(false); err != nil {
+		conn.Close()
+		return nil, nil, nil, fmt.Errorf("confirm mode: %w", err)
+	}
+	if err := ch.ExchangeDeclare(
+		p.eventsExchange,
+		"topic",
+		true,  // durable
+		false, // auto delete
+		false, // internal
 		false, // no wait
 		nil,
-	)
+	); err != nil {
+		conn.Close()
+		return nil, nil, nil, fmt.Errorf("declare events exchange: %w", err)
+	}
+	returns := newReturnRouter(ch.NotifyReturn(make(chan amqp.Return, 1)))
+	return conn, ch, returns, nil
+}
+
+func (p *TransactionClient) WithQueue(qName string, durable, autoDelete bool) *TransactionClient {
+	p.connMu.Lock()
+	defer p.connMu.Unlock()
+
+	p.queue = &queueOptions{qName, durable, autoDelete}
+	name, err := p.declare(p.ch)
 	if err != nil {
 		slog.Error("decalre queue", slog.Any("error", err))
 		panic(err)
 	}
-	p.qName = q.Name
+	p.qName = name
 	return p
 }
 
 // consumer="" for random consumer name
 func (p *TransactionClient) WithConsumer(consumer string) *TransactionClient {
-	msgs, err := p.ch.Consume(
-		p.qName,
-		consumer,
+	p.connMu.Lock()
+	defer p.connMu.Unlock()
+
+	p.consumer = &consumer
+	msgs, err := p.consume(p.ch, p.qName)
+	if err != nil {
+		slog.Error("consumer", slog.Any("error", err))
+		panic(err)
+	}
+	go p.replies.Dispatch(msgs)
+	return p
+}
+
+func (p *TransactionClient) declare(ch *amqp.Channel) (string, error) {
+	q, err := ch.QueueDeclare(
+		p.queue.name,
+		p.queue.durable,
+		p.queue.autoDelete,
+		true,  // exclusive
+		false, // no wait
+		nil,
+	)
+	return q.Name, err
+}
+
+func (p *TransactionClient) consume(ch *amqp.Channel, qName string) (<-chan amqp.Delivery, error) {
+	return ch.Consume(
+		qName,
+		*p.consumer,
 		true,  // auto ack
 		false, // exclusive
 		false, // no local
 		false, // no wait
 		nil,
 	)
+}
+
+// Degraded reports whether the client is reconnecting to the broker, Publish fails with ErrBrokerUnavailable meanwhile.
+func (p *TransactionClient) Degraded() bool {
+	return p.reconnector.Degraded()
+}
+
+// watch waits until the connection or the channel is closed and reconnects unless the client is closed.
+func (p *TransactionClient) watch(conn *amqp.Connection, ch *amqp.Channel) {
+	var reason *amqp.Error
+	select {
+	case reason = <-conn.NotifyClose(make(chan *amqp.Error, 1)):
+	case reason = <-ch.NotifyClose(make(chan *amqp.Error, 1)):
+		conn.Close()
+	}
+	if p.reconnector.Closed() {
+		return
+	}
+
+	slog.Error("rabbit connection lost", slog.Any("error", reason))
+	if p.reconnector.Reconnect() {
+		slog.Info("rabbit connection restored")
+	}
+}
+
+// connect dials the broker and restores the reply queue, the consumers and the watch of the new connection.
+func (p *TransactionClient) connect() error {
+	conn, ch, returns, err := p.dial()
 	if err != nil {
-		slog.Error("consumer", slog.Any("error", err))
-		panic(err)
+		return err
 	}
-	p.msgs = msgs
-	return p
+
+	p.connMu.Lock()
+	defer p.connMu.Unlock()
+	if p.reconnector.Closed() {
+		conn.Close()
+		return nil
+	}
+
+	qName := p.qName
+	if p.queue != nil {
+		if qName, err = p.declare(ch); err != nil {
+			conn.Close()
+			return fmt.Errorf("declare queue: %w", err)
+		}
+	}
+	if p.consumer != nil {
+		msgs, err := p.consume(ch, qName)
+		if err != nil {
+			conn.Close()
+			return fmt.Errorf("consumer: %w", err)
+		}
+		go p.replies.Dispatch(msgs)
+	}
+	if p.deadLetters != nil {
+		msgs, err := p.consumeDeadLetters(ch)
+		if err != nil {
+			conn.Close()
+			return err
+		}
+		go p.dispatchDeadLetters(msgs)
+	}
+
+	p.conn, p.ch, p.returns, p.qName = conn, ch, returns, qName
+	go p.watch(conn, ch)
+	return nil
 }
 
-// timeout in seconds
-func (p *TransactionClient) ProcessTransaction(ctx context.Context, transactionId uint) (model.Status, error) {
-	status := model.Error
+// resume publishes the awaited requests again, because the replies to the lost exclusive queue are lost too.
+// The delivery is at-least-once: the processor may get a transaction twice and must dedupe by the message id,
+// duplicated replies are dropped by the dispatcher.
+func (p *TransactionClient) resume() {
+	for _, transaction := range p.replies.Pending() {
+		if err := p.publish(context.Background(), transaction); err != nil {
+			slog.Error("failed to resume transaction", slog.Uint64("transactionId", uint64(transaction.Id)), slog.Any("error", err))
+		}
+	}
+}
 
-	id := fmt.Sprintf("%d", transactionId)
-	if err := p.ch.PublishWithContext(ctx,
+// Publish sends the transaction to the processor, the reply is delivered to the client queue.
+// The reply waiter is registered before publishing, so a fast reply is not lost before Await.
+func (p *TransactionClient) Publish(ctx context.Context, transaction model.Transaction) error {
+	if p.Degraded() {
+		return errs.ErrBrokerUnavailable
+	}
+
+	p.replies.Expect(transaction)
+	err := p.publish(ctx, transaction)
+	if err != nil {
+		p.replies.Forget(transaction.Id)
+	}
+	return err
+}
+
+// publish sends the transaction as a mandatory message and waits for the broker confirmation.
+// It fails with ErrUnroutable if no queue is bound to process_transaction and with ErrPublishNotConfirmed
+// if the broker nacks the message or does not confirm it in time.
+func (p *TransactionClient) publish(ctx context.Context, transaction model.Transaction) error {
+	// destination is passed in headers, so processors reading only the id from the body keep working
+	headers := amqp.Table{}
+	if transaction.Destination != nil {
+		headers["destination_type"] = string(transaction.Destination.Type)
+		headers["destination"] = transaction.Destination.Number
+	}
+
+	p.publishMu.Lock()
+	defer p.publishMu.Unlock()
+	p.connMu.RLock()
+	defer p.connMu.RUnlock()
+
+	id := correlationId(transaction.Id)
+	confirmation, err := p.ch.PublishWithDeferredConfirmWithContext(ctx,
 		"",
-		"process_transaction",
-		false,
+		processQueue,
+		true, // mandatory
 		false,
 		amqp.Publishing{
+			Headers:       headers,
 			ContentType:   "text/plain",
 			CorrelationId: id,
-			ReplyTo:       p.qName,
-			Body:          []byte(id),
+			// the idempotency key of the processor, the same transaction is published again after reconnect
+			MessageId: id,
+			ReplyTo:   p.qName,
+			Body:      []byte(id),
 		},
-	); err != nil {
-		return status, err
+	)
+	if errors.Is(err, amqp.ErrClosed) {
+		return fmt.Errorf("%w: %w", errs.ErrBrokerUnavailable, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.confirmTimeout)
+	defer cancel()
+	acked, err := confirmation.WaitContext(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errs.ErrPublishNotConfirmed, err)
+	}
+	if !acked {
+		return fmt.Errorf("%w: nacked by the broker", errs.ErrPublishNotConfirmed)
+	}
+
+	// an unroutable message is acked as well, the return has arrived before the ack
+	if ret := p.returns.Collect(ctx, id); ret != nil {
+		return fmt.Errorf("%w: %d %s", errs.ErrUnroutable, ret.ReplyCode, ret.ReplyText)
 	}
+	return nil
+}
 
-	var (
-		result int
-		err    error
+// PublishEvent sends the event to the events exchange and waits for the broker confirmation,
+// an event without subscribers is dropped by the broker.
+func (p *TransactionClient) PublishEvent(ctx context.Context, event model.Event) error {
+	if p.Degraded() {
+		return errs.ErrBrokerUnavailable
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	p.publishMu.Lock()
+	defer p.publishMu.Unlock()
+	p.connMu.RLock()
+	defer p.connMu.RUnlock()
+
+	confirmation, err := p.ch.PublishWithDeferredConfirmWithContext(ctx,
+		p.eventsExchange,
+		event.RoutingKey,
+		false,
+		false,
+		amqp.Publishing{
+			Headers:      amqp.Table{"type": string(event.Type), "version": int32(event.Version)},
+			ContentType:  "application/json",
+			DeliveryMode: amqp.Persistent,
+			MessageId:    fmt.Sprintf("%d", event.Id),
+			Timestamp:    event.OccurredAt,
+			Type:         string(event.Type),
+			Body:         body,
+		},
 	)
-	for d := range p.msgs {
-		if id == d.CorrelationId {
-			result, err = strconv.Atoi(string(d.Body))
-			break
-		}
+	if errors.Is(err, amqp.ErrClosed) {
+		return fmt.Errorf("%w: %w", errs.ErrBrokerUnavailable, err)
 	}
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.confirmTimeout)
+	defer cancel()
+	acked, err := confirmation.WaitContext(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errs.ErrPublishNotConfirmed, err)
+	}
+	if !acked {
+		return fmt.Errorf("%w: nacked by the broker", errs.ErrPublishNotConfirmed)
+	}
+	return nil
+}
+
+// Await waits for the processor reply to the published transaction.
+// It returns ErrProcessingTimeout if there is no reply before the ctx deadline or the client reply timeout.
+func (p *TransactionClient) Await(ctx context.Context, transactionId uint) (model.Status, error) {
+	return p.replies.Await(ctx, transactionId)
+}
 
-	return model.Status(result), err
+func (p *TransactionClient) ProcessTransaction(ctx context.Context, transaction model.Transaction) (model.Status, error) {
+	if err := p.Publish(ctx, transaction); err != nil {
+		return model.Error, err
+	}
+	return p.Await(ctx, transaction.Id)
 }
 
 func (p *TransactionClient) Close() {
-	p.conn.Close()
+	p.reconnector.Close()
+
+	p.connMu.RLock()
+	defer p.connMu.RUnlock()
 	p.ch.Close()
+	p.conn.Close()
 }
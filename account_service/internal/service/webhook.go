@@ -0,0 +1,200 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"accountservice/internal/errs"
+	"accountservice/internal/model"
+	"accountservice/internal/repo"
+)
+
+const (
+	WebhookIdHeader        = "X-Webhook-Id"
+	WebhookSignatureHeader = "X-Webhook-Signature"
+	// maxWebhookDelay caps the exponential delay between delivery attempts
+	maxWebhookDelay = time.Hour
+)
+
+// NewWebhookSecret generates a random secret to sign the webhook payloads.
+func NewWebhookSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+// SignWebhook returns the X-Webhook-Signature value "t=<unix time>,v1=<hex HMAC-SHA256 of "<unix time>.<body>">".
+// The time is signed too, so receivers can reject replayed payloads.
+func SignWebhook(secret string, timestamp time.Time, body []byte) string {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return fmt.Sprintf("t=%s,v1=%s", t, hex.EncodeToString(mac.Sum(nil)))
+}
+
+// publicIP reports whether webhooks can be sent to the ip, internal services must not be reachable through them.
+func publicIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsUnspecified() &&
+		!ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() && !ip.IsInterfaceLocalMulticast()
+}
+
+// CheckWebhookHost resolves the webhook host and returns ErrPrivateAddress if any of its addresses is not public.
+func CheckWebhookHost(ctx context.Context, host string) error {
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		if !publicIP(addr.IP) {
+			return fmt.Errorf("%w: %s resolves to %s", errs.ErrPrivateAddress, host, addr.IP)
+		}
+	}
+	return nil
+}
+
+// newWebhookClient returns the client of the webhook requests, it does not follow redirects.
+// Unless allowPrivate is set, it also refuses to connect to addresses which are not public,
+// so a host can't be pointed to one after it is checked on registration.
+func newWebhookClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	client := &http.Client{
+		Timeout: timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	if allowPrivate {
+		return client
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   timeout,
+		KeepAlive: 30 * time.Second,
+		// the address is already resolved here, so the check is not raced by DNS
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+				return fmt.Errorf("%w: %s", errs.ErrPrivateAddress, address)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// a proxy would connect to the webhook host on behalf of the service
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	client.Transport = transport
+	return client
+}
+
+// WebhookDispatcher sends the queued webhook deliveries and retries failed ones with exponential backoff.
+type WebhookDispatcher struct {
+	webhookRepo repo.WebhookRepo
+	client      *http.Client
+	interval    time.Duration
+	batchSize   int
+	maxAttempts int
+	baseDelay   time.Duration
+}
+
+// NewWebhookDispatcher sends the deliveries to public addresses only, unless allowPrivate is set.
+func NewWebhookDispatcher(wr repo.WebhookRepo, timeout, interval time.Duration, batchSize, maxAttempts int, baseDelay time.Duration, allowPrivate bool) WebhookDispatcher {
+	return WebhookDispatcher{
+		webhookRepo: wr,
+		client:      newWebhookClient(timeout, allowPrivate),
+		interval:    interval,
+		batchSize:   batchSize,
+		maxAttempts: maxAttempts,
+		baseDelay:   baseDelay,
+	}
+}
+
+func (d WebhookDispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for {
+			attempted, err := d.webhookRepo.Deliver(ctx, d.batchSize, d.lease(), func(delivery model.WebhookDelivery) model.WebhookAttempt {
+				return d.Deliver(ctx, delivery)
+			})
+			if err != nil {
+				slog.Error("failed to deliver webhooks", slog.Any("error", err))
+				break
+			}
+			if attempted < d.batchSize {
+				break
+			}
+		}
+	}
+}
+
+// lease is the time a batch of deliveries is claimed for, it lets every delivery of the batch time out.
+func (d WebhookDispatcher) lease() time.Duration {
+	return time.Duration(d.batchSize)*d.client.Timeout + d.interval
+}
+
+// Deliver posts the signed payload once, any 2xx response is a successful delivery and redirects are not followed.
+func (d WebhookDispatcher) Deliver(ctx context.Context, delivery model.WebhookDelivery) model.WebhookAttempt {
+	attempt := model.WebhookAttempt{Attempt: delivery.Attempts + 1}
+
+	err := func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Url, bytes.NewReader(delivery.Payload))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(WebhookIdHeader, strconv.FormatUint(uint64(delivery.Id), 10))
+		req.Header.Set(WebhookSignatureHeader, SignWebhook(delivery.Secret, time.Now(), delivery.Payload))
+
+		resp, err := d.client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		_, _ = io.Copy(io.Discard, resp.Body)
+
+		attempt.ResponseCode = resp.StatusCode
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return fmt.Errorf("unexpected status %d", resp.StatusCode)
+		}
+		return nil
+	}()
+	if err == nil {
+		attempt.Delivered = true
+		return attempt
+	}
+
+	attempt.Error = err.Error()
+	if attempt.Attempt < d.maxAttempts {
+		// the shift is limited to not overflow before the cap is applied
+		next := time.Now().UTC().Add(min(d.baseDelay<<min(attempt.Attempt-1, 20), maxWebhookDelay))
+		attempt.NextAttemptAt = &next
+	}
+	slog.Warn("webhook delivery failed", slog.Uint64("deliveryId", uint64(delivery.Id)), slog.Int("attempt", attempt.Attempt), slog.Any("error", err))
+	return attempt
+}
@@ -0,0 +1,172 @@
+package middleware_test
+
+import (
+	"accountservice/internal/api/middleware"
+	"accountservice/internal/model"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryIdempotencyRepo keeps the records in a map, expiration is not needed by the tests.
+type memoryIdempotencyRepo struct {
+	mu       sync.Mutex
+	records  map[string]model.IdempotencyRecord
+	released []string
+}
+
+func newMemoryIdempotencyRepo() *memoryIdempotencyRepo {
+	return &memoryIdempotencyRepo{records: make(map[string]model.IdempotencyRecord)}
+}
+
+func (r *memoryIdempotencyRepo) Reserve(c context.Context, key, fingerprint string, retention, lease time.Duration) (model.IdempotencyRecord, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if record, ok := r.records[key]; ok {
+		return record, false, nil
+	}
+	record := model.IdempotencyRecord{Key: key, Fingerprint: fingerprint}
+	r.records[key] = record
+	return record, true, nil
+}
+
+func (r *memoryIdempotencyRepo) Complete(c context.Context, record model.IdempotencyRecord) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored := r.records[record.Key]
+	record.Fingerprint = stored.Fingerprint
+	r.records[record.Key] = record
+	return nil
+}
+
+func (r *memoryIdempotencyRepo) Release(c context.Context, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.records, key)
+	r.released = append(r.released, key)
+	return nil
+}
+
+func (r *memoryIdempotencyRepo) Purge(c context.Context, retention time.Duration, limit int) (int, error) {
+	return 0, nil
+}
+
+func newApp(r *memoryIdempotencyRepo, handler fiber.Handler) *fiber.App {
+	app := fiber.New(fiber.Config{
+		ErrorHandler: func(c *fiber.Ctx, e error) error {
+			var err model.ErrorResponse
+			if !errors.As(e, &err) {
+				return c.Status(http.StatusInternalServerError).SendString(e.Error())
+			}
+			return c.Status(err.Code).JSON(err)
+		},
+	})
+	app.Post("/invoice", middleware.Idempotency(r, time.Hour, time.Minute), handler)
+	return app
+}
+
+func post(t *testing.T, app *fiber.App, key, body string) (*http.Response, string) {
+	req := httptest.NewRequest(http.MethodPost, "/invoice", strings.NewReader(body))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	if key != "" {
+		req.Header.Set(middleware.IdempotencyKeyHeader, key)
+	}
+	resp, err := app.Test(req, -1)
+	require.NoError(t, err)
+	respBody, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, string(respBody)
+}
+
+func TestIdempotencyReplay(t *testing.T) {
+	r := newMemoryIdempotencyRepo()
+	calls := 0
+	app := newApp(r, func(c *fiber.Ctx) error {
+		calls++
+		c.Location("/api/transactions/1")
+		return c.Status(http.StatusCreated).JSON(fiber.Map{"id": calls})
+	})
+
+	first, firstBody := post(t, app, "key-1", `{"amount": 10}`)
+	assert.Equal(t, http.StatusCreated, first.StatusCode)
+	assert.Empty(t, first.Header.Get(middleware.IdempotentReplayedHeader))
+
+	replay, replayBody := post(t, app, "key-1", `{"amount": 10}`)
+	assert.Equal(t, http.StatusCreated, replay.StatusCode)
+	assert.Equal(t, "true", replay.Header.Get(middleware.IdempotentReplayedHeader))
+	assert.Equal(t, "/api/transactions/1", replay.Header.Get(fiber.HeaderLocation))
+	assert.Equal(t, firstBody, replayBody)
+	assert.Equal(t, 1, calls)
+
+	// requests without the key are never replayed
+	post(t, app, "", `{"amount": 10}`)
+	post(t, app, "", `{"amount": 10}`)
+	assert.Equal(t, 3, calls)
+}
+
+func TestIdempotencyConflicts(t *testing.T) {
+	r := newMemoryIdempotencyRepo()
+	app := newApp(r, func(c *fiber.Ctx) error {
+		return c.SendStatus(http.StatusCreated)
+	})
+
+	post(t, app, "key-1", `{"amount": 10}`)
+	resp, _ := post(t, app, "key-1", `{"amount": 20}`)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode, "reused key with another body should conflict")
+
+	// a reserved key without a stored response belongs to a request in progress
+	_, _, err := r.Reserve(context.Background(), "key-2", "", time.Hour, time.Minute)
+	require.NoError(t, err)
+	resp, _ = post(t, app, "key-2", ``)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode, "key of a request in progress should conflict")
+
+	resp, _ = post(t, app, strings.Repeat("k", 256), `{}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestIdempotencyReleaseOnError(t *testing.T) {
+	var tests = []struct {
+		name     string
+		handler  fiber.Handler
+		released bool
+	}{
+		{"Server error should release the key", func(c *fiber.Ctx) error {
+			return model.ErrorResponse{Code: http.StatusInternalServerError, Msg: "failed"}
+		}, true},
+		{"Unexpected error should release the key", func(c *fiber.Ctx) error {
+			return errors.New("boom")
+		}, true},
+		{"Client error should be stored", func(c *fiber.Ctx) error {
+			return model.ErrorResponse{Code: http.StatusBadRequest, Msg: "invalid"}
+		}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newMemoryIdempotencyRepo()
+			app := newApp(r, tt.handler)
+
+			post(t, app, "key-1", `{}`)
+			if tt.released {
+				assert.Equal(t, []string{"key-1"}, r.released)
+				assert.NotContains(t, r.records, "key-1")
+				return
+			}
+			assert.Empty(t, r.released)
+			assert.Equal(t, http.StatusBadRequest, r.records["key-1"].StatusCode)
+
+			resp, _ := post(t, app, "key-1", `{}`)
+			assert.Equal(t, "true", resp.Header.Get(middleware.IdempotentReplayedHeader))
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package money_test
+
+import (
+	"accountservice/internal/money"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	var tests = []struct {
+		name        string
+		input       string
+		expected    string
+		expectedErr bool
+	}{
+		{"Integer should be parsed", "100", "100", false},
+		{"Fraction should be parsed", "831.3240", "831.324", false},
+		{"Negative fraction should be parsed", "-0.05", "-0.05", false},
+		{"Leading dot should be parsed", ".5", "0.5", false},
+		{"Exponent should be parsed", "1.5e3", "1500", false},
+		{"Negative exponent should be parsed", "15e-4", "0.0015", false},
+		{"Empty string should fail", "", "", true},
+		{"Double sign should fail", "--1", "", true},
+		{"Two dots should fail", "1.2.3", "", true},
+		{"Letters should fail", "ten", "", true},
+		{"Bounded exponent should be parsed", "1e32", "100000000000000000000000000000000", false},
+		{"Huge exponent should fail", "1e100000000", "", true},
+		{"Huge negative exponent should fail", "1e-33", "", true},
+		{"Too many digits should fail", "0." + strings.Repeat("1", 38), "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := money.Parse(tt.input)
+			if tt.expectedErr {
+				require.ErrorIs(t, err, money.ErrInvalidAmount)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, got.String())
+		})
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	a, b := money.MustParse("831.32"), money.MustParse("0.004")
+
+	// 0.1 + 0.2 is exact unlike float64
+	assert.Equal(t, "0.3", money.MustParse("0.1").Add(money.MustParse("0.2")).String())
+	assert.Equal(t, "831.324", a.Add(b).String())
+	assert.Equal(t, "831.316", a.Sub(b).String())
+	assert.Equal(t, "-831.32", a.Neg().String())
+	assert.Equal(t, "3.32528", a.Mul(b).String())
+	assert.Equal(t, 1, a.Cmp(b))
+	assert.True(t, money.MustParse("10.00").Equal(money.New(10, 0)))
+	assert.True(t, a.Sub(a).IsZero())
+}
+
+func TestRound(t *testing.T) {
+	var tests = []struct {
+		name     string
+		input    string
+		places   int32
+		expected string
+	}{
+		{"Half should be rounded up", "0.125", 2, "0.13"},
+		{"Negative half should be rounded away from zero", "-0.125", 2, "-0.13"},
+		{"Less than half should be rounded down", "0.124", 2, "0.12"},
+		{"Amount with less places should not change", "0.1", 2, "0.1"},
+		{"Rounding to integer", "99.5", 0, "100"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, money.MustParse(tt.input).Round(tt.places).String())
+		})
+	}
+}
+
+func TestQuo(t *testing.T) {
+	assert.Equal(t, "33.33", money.New(100, 0).Quo(money.New(3, 0), 2).String())
+	assert.Equal(t, "66.67", money.New(200, 0).Quo(money.New(3, 0), 2).String())
+	assert.Equal(t, "-0.67", money.MustParse("-2").Quo(money.MustParse("3"), 2).String())
+	assert.Equal(t, "1115", money.MustParse("100000").Quo(money.MustParse("89.6883"), 0).String())
+}
+
+func TestCurrency(t *testing.T) {
+	assert.Equal(t, int32(2), money.MinorUnits("RUB"))
+	assert.Equal(t, int32(0), money.MinorUnits("JPY"))
+	assert.Equal(t, int32(3), money.MinorUnits("KWD"))
+
+	assert.True(t, money.MustParse("10.50").FitsCurrency("USD"))
+	assert.False(t, money.MustParse("10.505").FitsCurrency("USD"))
+	assert.False(t, money.MustParse("10.5").FitsCurrency("JPY"))
+	assert.Equal(t, "11", money.MustParse("10.5").RoundTo("JPY").String())
+}
+
+func TestJSON(t *testing.T) {
+	var in struct {
+		Number money.Amount `json:"number"`
+		Quoted money.Amount `json:"quoted"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(`{"number": 831.32, "quoted": "0.10"}`), &in))
+	assert.Equal(t, "831.32", in.Number.String())
+	assert.Equal(t, "0.1", in.Quoted.String())
+
+	out, err := json.Marshal(in)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"number": 831.32, "quoted": 0.1}`, string(out))
+
+	require.Error(t, json.Unmarshal([]byte(`{"number": "abc"}`), &in))
+	// the controllers tell invalid amounts apart from malformed bodies
+	require.ErrorIs(t, json.Unmarshal([]byte(`{"number": 1e100000000}`), &in), money.ErrInvalidAmount)
+}
+
+func TestNumeric(t *testing.T) {
+	amount := money.MustParse("-12.345")
+	n, err := amount.NumericValue()
+	require.NoError(t, err)
+
+	var got money.Amount
+	require.NoError(t, got.ScanNumeric(n))
+	assert.True(t, amount.Equal(got))
+
+	require.Error(t, got.ScanNumeric(pgtype.Numeric{}))
+	require.Error(t, got.ScanNumeric(pgtype.Numeric{NaN: true, Valid: true}))
+}
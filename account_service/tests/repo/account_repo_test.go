@@ -3,7 +3,9 @@ package repo_test
 import (
 	"accountservice/internal/config"
 	"accountservice/internal/database"
+	"accountservice/internal/errs"
 	"accountservice/internal/model"
+	"accountservice/internal/money"
 	"accountservice/internal/repo"
 	"context"
 	"fmt"
@@ -11,6 +13,7 @@ import (
 	"testing"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -32,22 +35,24 @@ func TestMain(m *testing.M) {
 func run(m *testing.M) (int, error) {
 	cfg = config.MustNewConfig("../../.env").WithDbHost("localhost")
 	db = database.MustNewPostgres(cfg, 3)
+	defer db.Close()
+
+	ctx := context.Background()
+	if _, err := database.MigrateUp(ctx, db); err != nil {
+		return 1, err
+	}
 	defer func() {
-		_, _ = db.Exec(context.Background(), `
-			drop table if exists transactions; 
-			drop table if exists accounts;
-		`)
-		db.Close()
+		migrations, _ := database.Migrations()
+		if _, err := database.MigrateDown(ctx, db, len(migrations)); err != nil {
+			fmt.Println(err)
+		}
 	}()
 
 	return m.Run(), nil
 }
 
 func TestAccountRepoInsertOne(t *testing.T) {
-	accountRepo, err := repo.NewAccountPostgresRepo(db)
-	if err != nil {
-		t.Fatal(err)
-	}
+	accountRepo := repo.NewAccountPostgresRepo(db)
 
 	var tests = []struct {
 		name              string
@@ -60,16 +65,16 @@ func TestAccountRepoInsertOne(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			ctx := context.Background()
-			gotAccountId, err := accountRepo.InsertOne(ctx)
+			gotAccount, err := accountRepo.InsertOne(ctx, model.AccountRequest{OwnerRef: "test", Currency: "RUB"})
 			require.NoError(t, err)
-			assert.Equal(t, tt.expectedAccountId, gotAccountId)
+			assert.Equal(t, tt.expectedAccountId, gotAccount.Id)
+			assert.Equal(t, "RUB", gotAccount.Currency)
 		})
 	}
 }
 
 func TestAccountRepoFindOne(t *testing.T) {
-	accountRepo, err := repo.NewAccountPostgresRepo(db)
-	require.NoError(t, err)
+	accountRepo := repo.NewAccountPostgresRepo(db)
 
 	var tests = []struct {
 		name            string
@@ -94,18 +99,15 @@ func TestAccountRepoFindOne(t *testing.T) {
 }
 
 func TestAccountRepoFindAll(t *testing.T) {
-	accountRepo, err := repo.NewAccountPostgresRepo(db)
-	if err != nil {
-		t.Fatal(err)
-	}
+	accountRepo := repo.NewAccountPostgresRepo(db)
 
 	var tests = []struct {
 		name             string
 		expectedAccounts []model.Account
 	}{
 		{"Selecting all accounts should return two accounts", []model.Account{
-			{Id: 1, Balance: 0, Frozen: 0},
-			{Id: 2, Balance: 0, Frozen: 0},
+			{Id: 1},
+			{Id: 2},
 		}},
 	}
 
@@ -120,24 +122,23 @@ func TestAccountRepoFindAll(t *testing.T) {
 }
 
 func TestAccountRepoUpdateOne(t *testing.T) {
-	accountRepo, err := repo.NewAccountPostgresRepo(db)
-	if err != nil {
-		t.Fatal(err)
-	}
+	accountRepo := repo.NewAccountPostgresRepo(db)
 
 	var tests = []struct {
 		name           string
 		inputAccountId uint
-		inputBalance   float64
-		inputFrozen    float64
+		inputCurrency  string
+		inputBalance   money.Amount
+		inputFrozen    money.Amount
 	}{
-		{"Balance diff should be +100, frozen diff should be +100", 1, 100, 100},
-		{"Balance diff should be 0, frozen diff should be +100", 1, 0, 100},
-		{"Balance diff should be 0, frozen diff should be -100", 1, 0, -100},
-		{"Balance diff should be -100, frozen diff should be 0", 1, -100, 0},
-		{"Balance diff should be +100, frozen diff should be 0", 1, +100, 0},
-		{"Balance diff should be -100, frozen diff should be -100", 1, -100, -100},
-		{"Balance diff should be 0, frozen diff should be 0", 1, 0, 0},
+		{"Balance diff should be +100, frozen diff should be +100", 1, "RUB", money.New(100, 0), money.New(100, 0)},
+		{"Balance diff should be 0, frozen diff should be +100", 1, "RUB", money.New(0, 0), money.New(100, 0)},
+		{"Balance diff should be 0, frozen diff should be -100", 1, "RUB", money.New(0, 0), money.New(-100, 0)},
+		{"Balance diff should be -100, frozen diff should be 0", 1, "RUB", money.New(-100, 0), money.New(0, 0)},
+		{"Balance diff should be +100, frozen diff should be 0", 1, "RUB", money.New(100, 0), money.New(0, 0)},
+		{"Balance diff should be -100, frozen diff should be -100", 1, "RUB", money.New(-100, 0), money.New(-100, 0)},
+		{"Balance diff should be 0, frozen diff should be 0", 1, "RUB", money.New(0, 0), money.New(0, 0)},
+		{"USD wallet should be changed separately", 1, "USD", money.New(100, 0), money.New(0, 0)},
 	}
 
 	for _, tt := range tests {
@@ -147,14 +148,82 @@ func TestAccountRepoUpdateOne(t *testing.T) {
 			oldAccount, err := accountRepo.FindOne(ctx, tt.inputAccountId)
 			require.NoError(t, err)
 
-			err = accountRepo.UpdateOne(ctx, tt.inputAccountId, tt.inputBalance, tt.inputFrozen)
+			err = accountRepo.UpdateOne(ctx, tt.inputAccountId, tt.inputCurrency, tt.inputBalance, tt.inputFrozen)
+			require.NoError(t, err)
+
+			gotAccount, err := accountRepo.FindOne(ctx, tt.inputAccountId)
+			require.NoError(t, err)
+
+			oldWallet, gotWallet := oldAccount.Wallet(tt.inputCurrency), gotAccount.Wallet(tt.inputCurrency)
+			assert.Equal(t, oldWallet.Balance.Add(tt.inputBalance).String(), gotWallet.Balance.String())
+			assert.Equal(t, oldWallet.Frozen.Add(tt.inputFrozen).String(), gotWallet.Frozen.String())
+		})
+	}
+}
+
+func TestAccountRepoPost(t *testing.T) {
+	accountRepo := repo.NewAccountPostgresRepo(db)
+
+	var tests = []struct {
+		name           string
+		inputAccountId uint
+		inputPostings  []model.Posting
+		expectedError  error
+	}{
+		{"Unbalanced entry should be rejected", 1, []model.Posting{
+			{AccountId: 1, Bucket: model.Frozen, Currency: "RUB", Amount: money.New(100, 0)},
+			{Bucket: model.Settlement, Currency: "RUB", Amount: money.New(-50, 0)},
+		}, errs.ErrUnbalancedEntry},
+		{"Entry balanced across different currencies should be rejected", 1, []model.Posting{
+			{AccountId: 1, Bucket: model.Frozen, Currency: "USD", Amount: money.New(100, 0)},
+			{Bucket: model.Settlement, Currency: "RUB", Amount: money.New(-100, 0)},
+		}, errs.ErrUnbalancedEntry},
+		{"Invoice hold should increase frozen", 1, []model.Posting{
+			{AccountId: 1, Bucket: model.Frozen, Currency: "RUB", Amount: money.New(100, 0)},
+			{Bucket: model.Settlement, Currency: "RUB", Amount: money.New(-100, 0)},
+		}, nil},
+		{"Invoice settlement should move frozen to balance", 1, []model.Posting{
+			{AccountId: 1, Bucket: model.Frozen, Currency: "RUB", Amount: money.New(-100, 0)},
+			{AccountId: 1, Bucket: model.Available, Currency: "RUB", Amount: money.New(100, 0)},
+		}, nil},
+		{"Posting to unexisting account should fail", 9999, []model.Posting{
+			{AccountId: 9999, Bucket: model.Frozen, Currency: "RUB", Amount: money.New(100, 0)},
+			{Bucket: model.Settlement, Currency: "RUB", Amount: money.New(-100, 0)},
+		}, &pgconn.PgError{Code: "23503"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			oldAccount, _ := accountRepo.FindOne(ctx, tt.inputAccountId)
+			_, err := accountRepo.Post(ctx, model.JournalEntry{Kind: model.Adjust, Postings: tt.inputPostings})
+			if tt.expectedError != nil {
+				require.Error(t, err)
+				if pgErr, ok := tt.expectedError.(*pgconn.PgError); ok {
+					require.ErrorAs(t, err, &pgErr)
+				} else {
+					require.ErrorIs(t, err, tt.expectedError)
+				}
+				return
+			}
 			require.NoError(t, err)
 
 			gotAccount, err := accountRepo.FindOne(ctx, tt.inputAccountId)
 			require.NoError(t, err)
 
-			assert.Equal(t, oldAccount.Balance+tt.inputBalance, gotAccount.Balance)
-			assert.Equal(t, oldAccount.Frozen+tt.inputFrozen, gotAccount.Frozen)
+			var balanceChange, frozenChange money.Amount
+			for _, p := range tt.inputPostings {
+				switch p.Bucket {
+				case model.Available:
+					balanceChange = balanceChange.Add(p.Amount)
+				case model.Frozen:
+					frozenChange = frozenChange.Add(p.Amount)
+				}
+			}
+			assert.Equal(t, oldAccount.Wallet("RUB").Balance.Add(balanceChange).String(), gotAccount.Wallet("RUB").Balance.String())
+			assert.Equal(t, oldAccount.Wallet("RUB").Frozen.Add(frozenChange).String(), gotAccount.Wallet("RUB").Frozen.String())
+			require.NoError(t, accountRepo.Reconcile(ctx, tt.inputAccountId))
 		})
 	}
 }
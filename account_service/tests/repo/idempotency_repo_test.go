@@ -0,0 +1,90 @@
+package repo_test
+
+import (
+	"accountservice/internal/model"
+	"accountservice/internal/repo"
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdempotencyRepo(t *testing.T) {
+	idempotencyRepo := repo.NewIdempotencyPostgresRepo(db)
+	ctx := context.Background()
+
+	record, reserved, err := idempotencyRepo.Reserve(ctx, "key-1", "fingerprint-1", time.Hour, time.Hour)
+	require.NoError(t, err)
+	assert.True(t, reserved)
+	assert.Equal(t, "fingerprint-1", record.Fingerprint)
+
+	// the key of a request in progress has no status code yet
+	record, reserved, err = idempotencyRepo.Reserve(ctx, "key-1", "fingerprint-2", time.Hour, time.Hour)
+	require.NoError(t, err)
+	assert.False(t, reserved)
+	assert.Equal(t, "fingerprint-1", record.Fingerprint)
+	assert.Zero(t, record.StatusCode)
+
+	require.NoError(t, idempotencyRepo.Complete(ctx, model.IdempotencyRecord{
+		Key:         "key-1",
+		StatusCode:  http.StatusCreated,
+		ContentType: "application/json",
+		Location:    "/api/transactions/1",
+		Response:    []byte(`{"id":1}`),
+	}))
+	record, reserved, err = idempotencyRepo.Reserve(ctx, "key-1", "fingerprint-1", time.Hour, time.Hour)
+	require.NoError(t, err)
+	assert.False(t, reserved)
+	assert.Equal(t, http.StatusCreated, record.StatusCode)
+	assert.Equal(t, "/api/transactions/1", record.Location)
+	assert.Equal(t, `{"id":1}`, string(record.Response))
+
+	// a released key is reserved again
+	require.NoError(t, idempotencyRepo.Release(ctx, "key-1"))
+	_, reserved, err = idempotencyRepo.Reserve(ctx, "key-1", "fingerprint-2", time.Hour, time.Hour)
+	require.NoError(t, err)
+	assert.True(t, reserved)
+
+	// an expired key starts over
+	time.Sleep(10 * time.Millisecond)
+	record, reserved, err = idempotencyRepo.Reserve(ctx, "key-1", "fingerprint-3", time.Millisecond, time.Hour)
+	require.NoError(t, err)
+	assert.True(t, reserved)
+	assert.Equal(t, "fingerprint-3", record.Fingerprint)
+
+	// an abandoned request without a response is taken over after the lease
+	record, reserved, err = idempotencyRepo.Reserve(ctx, "key-1", "fingerprint-4", time.Hour, time.Hour)
+	require.NoError(t, err)
+	assert.False(t, reserved)
+	assert.Equal(t, "fingerprint-3", record.Fingerprint)
+	time.Sleep(10 * time.Millisecond)
+	record, reserved, err = idempotencyRepo.Reserve(ctx, "key-1", "fingerprint-4", time.Hour, time.Millisecond)
+	require.NoError(t, err)
+	assert.True(t, reserved)
+	assert.Equal(t, "fingerprint-4", record.Fingerprint)
+
+	// a completed request is kept for the retention even after the lease
+	require.NoError(t, idempotencyRepo.Complete(ctx, model.IdempotencyRecord{Key: "key-1", StatusCode: http.StatusCreated}))
+	time.Sleep(10 * time.Millisecond)
+	record, reserved, err = idempotencyRepo.Reserve(ctx, "key-1", "fingerprint-5", time.Hour, time.Millisecond)
+	require.NoError(t, err)
+	assert.False(t, reserved)
+	assert.Equal(t, http.StatusCreated, record.StatusCode)
+
+	// expired keys are purged in batches
+	_, _, err = idempotencyRepo.Reserve(ctx, "key-2", "fingerprint-1", time.Hour, time.Hour)
+	require.NoError(t, err)
+	time.Sleep(10 * time.Millisecond)
+	purged, err := idempotencyRepo.Purge(ctx, time.Millisecond, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+	purged, err = idempotencyRepo.Purge(ctx, time.Millisecond, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+	_, reserved, err = idempotencyRepo.Reserve(ctx, "key-1", "fingerprint-5", time.Hour, time.Hour)
+	require.NoError(t, err)
+	assert.True(t, reserved)
+}
@@ -0,0 +1,69 @@
+package repo_test
+
+import (
+	"accountservice/internal/model"
+	"accountservice/internal/money"
+	"accountservice/internal/repo"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateRepo(t *testing.T) {
+	rateRepo := repo.NewRatePostgresRepo(db)
+	ctx := context.Background()
+
+	usd := model.Rate{Currency: "USD", Value: money.MustParse("89.6883"), Nominal: money.New(1, 0), Source: "fixture"}
+	jpy := model.Rate{Currency: "JPY", Value: money.MustParse("61.0436"), Nominal: money.New(100, 0), Source: "fixture"}
+
+	var tests = []struct {
+		name             string
+		input            []model.Rate
+		expectedInserted int
+	}{
+		{"New rates should be inserted", []model.Rate{usd, jpy}, 2},
+		{"Unchanged rates should not be inserted", []model.Rate{usd, jpy}, 0},
+		{"Changed rate should be inserted", []model.Rate{{Currency: "USD", Value: money.MustParse("88.6603"), Nominal: money.New(1, 0), Source: "cbr"}, jpy}, 1},
+		{"Same rate from another source should be inserted", []model.Rate{{Currency: "JPY", Value: jpy.Value, Nominal: jpy.Nominal, Source: "cbr"}}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inserted, err := rateRepo.InsertMany(ctx, tt.input)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedInserted, inserted)
+		})
+	}
+
+	latest, err := rateRepo.FindLatest(ctx)
+	require.NoError(t, err)
+	require.Len(t, latest, 2)
+	assert.Equal(t, "JPY", latest[0].Currency)
+	assert.Equal(t, "cbr", latest[0].Source)
+	assert.Equal(t, "USD", latest[1].Currency)
+	assert.Equal(t, "88.6603", latest[1].Value.String())
+	assert.Equal(t, "cbr", latest[1].Source)
+
+	history, err := rateRepo.FindHistory(ctx, "USD", time.Time{}, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, "89.6883", history[0].Value.String())
+	require.NotNil(t, history[0].ValidTo)
+	assert.Equal(t, history[1].ValidFrom, *history[0].ValidTo)
+	assert.Nil(t, history[1].ValidTo)
+
+	// range bounds in another time zone address the same instant
+	from := history[1].ValidFrom.Add(-time.Minute).In(time.FixedZone("MSK", 3*60*60))
+	shifted, err := rateRepo.FindHistory(ctx, "USD", from, time.Time{})
+	require.NoError(t, err)
+	assert.Len(t, shifted, 2)
+
+	// the rate valid at the start of the range is included
+	history, err = rateRepo.FindHistory(ctx, "USD", history[1].ValidFrom.Add(time.Hour), time.Time{})
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, "88.6603", history[0].Value.String())
+}
@@ -1,21 +1,25 @@
 package repo_test
 
 import (
+	"accountservice/internal/errs"
 	"accountservice/internal/model"
+	"accountservice/internal/money"
 	"accountservice/internal/repo"
+	"accountservice/internal/service"
 	"context"
+	"errors"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 func TestTransactionRepoInsertOne(t *testing.T) {
-	transactionRepo, err := repo.NewTransactionPostgresRepo(db)
-	if err != nil {
-		t.Fatal(err)
-	}
+	transactionRepo := repo.NewTransactionPostgresRepo(db)
 
 	var tests = []struct {
 		name                  string
@@ -24,30 +28,42 @@ func TestTransactionRepoInsertOne(t *testing.T) {
 		expectedTransactionId uint
 		expectedError         *pgconn.PgError
 	}{
-		{"First transaction should have id 1", model.TransactionRequest{AccountId: 1, Amount: 100, Currency: "USD"}, model.Invoice, 1, nil},
-		{"Second transaction should have id 2", model.TransactionRequest{AccountId: 1, Amount: 100, Currency: "RUB"}, model.Withdraw, 2, nil},
-		{"Unexisting accountId should fail", model.TransactionRequest{AccountId: 3, Amount: 100, Currency: "RUB"}, model.Withdraw, 0, &pgconn.PgError{Code: "23503"}},
+		{"First transaction should have id 1", model.TransactionRequest{AccountId: 1, Amount: money.New(100, 0), Currency: "USD"}, model.Invoice, 1, nil},
+		{"Second transaction should have id 2", model.TransactionRequest{AccountId: 1, Amount: money.New(100, 0), Currency: "RUB"}, model.Withdraw, 2, nil},
+		{"Unexisting accountId should fail", model.TransactionRequest{AccountId: 3, Amount: money.New(100, 0), Currency: "RUB"}, model.Withdraw, 0, &pgconn.PgError{Code: "23503"}},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			ctx := context.Background()
-			gotTransactionId, err := transactionRepo.InsertOne(ctx, tt.input, tt.op)
+			rate, validFrom := money.MustParse("1.5"), time.Date(2024, 1, 13, 8, 30, 0, 0, time.UTC)
+			fx := model.FX{ConvertedAmount: tt.input.Amount.Mul(rate), Rate: &rate, RateSource: "fixture", RateValidFrom: &validFrom}
+			gotTransaction, err := transactionRepo.InsertOne(ctx, tt.input, tt.op, fx)
 			if err != nil {
 				if tt.expectedError != nil {
 					require.ErrorAs(t, err, &tt.expectedError)
 				}
 			}
-			assert.Equal(t, tt.expectedTransactionId, gotTransactionId)
+			assert.Equal(t, tt.expectedTransactionId, gotTransaction.Id)
+			if err != nil {
+				return
+			}
+
+			// the applied rate is stored with the transaction
+			storedTransaction, err := transactionRepo.FindOne(ctx, gotTransaction.Id)
+			require.NoError(t, err)
+			assert.Equal(t, "150", storedTransaction.ConvertedAmount.String())
+			require.NotNil(t, storedTransaction.Rate)
+			assert.Equal(t, "1.5", storedTransaction.Rate.String())
+			assert.Equal(t, "fixture", storedTransaction.RateSource)
+			require.NotNil(t, storedTransaction.RateValidFrom)
+			assert.True(t, validFrom.Equal(*storedTransaction.RateValidFrom))
 		})
 	}
 }
 
 func TestTransactionRepoUpdateOne(t *testing.T) {
-	transactionRepo, err := repo.NewTransactionPostgresRepo(db)
-	if err != nil {
-		t.Fatal(err)
-	}
+	transactionRepo := repo.NewTransactionPostgresRepo(db)
 
 	var tests = []struct {
 		name               string
@@ -73,3 +89,469 @@ func TestTransactionRepoUpdateOne(t *testing.T) {
 		})
 	}
 }
+
+func TestTransactionRepoFindPage(t *testing.T) {
+	transactionRepo := repo.NewTransactionPostgresRepo(db)
+
+	var (
+		ctx    = context.Background()
+		filter = model.TransactionFilter{AccountId: 1, Order: model.Desc, Limit: 1}
+	)
+
+	firstPage, err := transactionRepo.FindPage(ctx, filter)
+	require.NoError(t, err)
+	require.Len(t, firstPage.Transactions, 1)
+	assert.Equal(t, uint(2), firstPage.Transactions[0].Id)
+	require.NotEmpty(t, firstPage.NextCursor)
+
+	cursor, err := model.ParseTransactionCursor(firstPage.NextCursor)
+	require.NoError(t, err)
+	filter.Cursor = &cursor
+
+	secondPage, err := transactionRepo.FindPage(ctx, filter)
+	require.NoError(t, err)
+	require.Len(t, secondPage.Transactions, 1)
+	assert.Equal(t, uint(1), secondPage.Transactions[0].Id)
+	assert.Empty(t, secondPage.NextCursor)
+
+	var tests = []struct {
+		name          string
+		input         model.TransactionFilter
+		expectedCount int
+	}{
+		{"Filtering by currency should return one transaction", model.TransactionFilter{AccountId: 1, Currency: "USD", Limit: 10}, 1},
+		{"Filtering by operation should return one transaction", model.TransactionFilter{AccountId: 1, Operation: model.Withdraw, Limit: 10}, 1},
+		{"Filtering by amount range should return both transactions", model.TransactionFilter{AccountId: 1, MinAmount: &[]money.Amount{money.New(100, 0)}[0], Limit: 10}, 2},
+		{"Unexisting account should have no transactions", model.TransactionFilter{AccountId: 9999, Limit: 10}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := transactionRepo.FindPage(ctx, tt.input)
+			require.NoError(t, err)
+			assert.Len(t, page.Transactions, tt.expectedCount)
+		})
+	}
+}
+
+func TestTransactionRepoInsertTransfer(t *testing.T) {
+	transactionRepo := repo.NewTransactionPostgresRepo(db)
+	accountRepo := repo.NewAccountPostgresRepo(db)
+	uow := repo.NewUnitOfWork(db)
+
+	var tests = []struct {
+		name          string
+		input         model.TransferRequest
+		expectedError error
+	}{
+		{"Transfer within active balance should succeed", model.TransferRequest{FromAccountId: 1, ToAccountId: 2, Amount: money.New(50, 0), Currency: "USD"}, nil},
+		{"Transfer above active balance should fail", model.TransferRequest{FromAccountId: 1, ToAccountId: 2, Amount: money.New(1_000_000, 0), Currency: "USD"}, errs.ErrInsufficientFunds},
+		{"Transfer from empty wallet should fail", model.TransferRequest{FromAccountId: 2, ToAccountId: 1, Amount: money.New(1, 0), Currency: "EUR"}, errs.ErrInsufficientFunds},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			oldFrom, err := accountRepo.FindOne(ctx, tt.input.FromAccountId)
+			require.NoError(t, err)
+			oldTo, err := accountRepo.FindOne(ctx, tt.input.ToAccountId)
+			require.NoError(t, err)
+
+			var transaction model.Transaction
+			err = uow.Do(ctx, func(c context.Context) error {
+				var err error
+				if transaction, err = transactionRepo.InsertTransfer(c, tt.input, model.FX{ConvertedAmount: tt.input.Amount}); err != nil {
+					return err
+				}
+				_, err = accountRepo.Post(c, service.TransferEntry(transaction, transaction.Currency, transaction.Amount))
+				return err
+			})
+
+			gotFrom, findErr := accountRepo.FindOne(ctx, tt.input.FromAccountId)
+			require.NoError(t, findErr)
+			gotTo, findErr := accountRepo.FindOne(ctx, tt.input.ToAccountId)
+			require.NoError(t, findErr)
+
+			if tt.expectedError != nil {
+				require.ErrorIs(t, err, tt.expectedError)
+				assert.Equal(t, oldFrom.Wallet(tt.input.Currency).Balance.String(), gotFrom.Wallet(tt.input.Currency).Balance.String())
+				assert.Equal(t, oldTo.Wallet(tt.input.Currency).Balance.String(), gotTo.Wallet(tt.input.Currency).Balance.String())
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, model.Success, transaction.Status)
+			assert.Equal(t, oldFrom.Wallet(tt.input.Currency).Balance.Sub(tt.input.Amount).String(), gotFrom.Wallet(tt.input.Currency).Balance.String())
+			assert.Equal(t, oldTo.Wallet(tt.input.Currency).Balance.Add(tt.input.Amount).String(), gotTo.Wallet(tt.input.Currency).Balance.String())
+			require.NoError(t, accountRepo.Reconcile(ctx, tt.input.FromAccountId))
+			require.NoError(t, accountRepo.Reconcile(ctx, tt.input.ToAccountId))
+		})
+	}
+}
+
+func TestOutboxRepoRelay(t *testing.T) {
+	outboxRepo := repo.NewOutboxPostgresRepo(db)
+	ctx := context.Background()
+
+	// the publish error keeps the message in the outbox
+	sent, err := outboxRepo.Relay(ctx, 10, time.Minute, func(msg model.OutboxMessage) error {
+		return errors.New("broker is unavailable")
+	})
+	require.NoError(t, err)
+	assert.Empty(t, sent)
+
+	var published []uint
+	sent, err = outboxRepo.Relay(ctx, 10, time.Minute, func(msg model.OutboxMessage) error {
+		// the claim is committed before the publish, so the message is not published again meanwhile
+		again, err := outboxRepo.Relay(ctx, 10, time.Minute, func(msg model.OutboxMessage) error {
+			t.Fatalf("message %d is relayed while it is published", msg.Id)
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Empty(t, again)
+
+		published = append(published, msg.TransactionId)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Len(t, sent, 2)
+	assert.Equal(t, []uint{1, 2}, published)
+
+	sent, err = outboxRepo.Relay(ctx, 10, time.Minute, func(msg model.OutboxMessage) error {
+		t.Fatalf("message %d is relayed twice", msg.Id)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Empty(t, sent)
+}
+
+func TestTransactionRepoFinalize(t *testing.T) {
+	transactionRepo := repo.NewTransactionPostgresRepo(db)
+	accountRepo := repo.NewAccountPostgresRepo(db)
+	uow := repo.NewUnitOfWork(db)
+
+	ctx := context.Background()
+	var transaction model.Transaction
+	err := uow.Do(ctx, func(c context.Context) error {
+		var err error
+		if transaction, err = transactionRepo.InsertOne(c, model.TransactionRequest{AccountId: 2, Amount: money.New(10, 0), Currency: "EUR"}, model.Invoice, model.FX{ConvertedAmount: money.New(10, 0)}); err != nil {
+			return err
+		}
+		_, err = accountRepo.Post(c, service.HoldEntry(transaction))
+		return err
+	})
+	require.NoError(t, err)
+
+	var tests = []struct {
+		name              string
+		expectedFinalized bool
+	}{
+		{"Created transaction should be finalized", true},
+		{"Finalized transaction should not be finalized twice", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var finalized bool
+			err := uow.Do(ctx, func(c context.Context) error {
+				transaction, ok, err := transactionRepo.Finalize(c, transaction.Id, model.Success)
+				if err != nil || !ok {
+					return err
+				}
+				finalized = true
+				_, err = accountRepo.Post(c, service.SettleEntry(transaction, model.Success))
+				return err
+			})
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedFinalized, finalized)
+
+			account, err := accountRepo.FindOne(ctx, 2)
+			require.NoError(t, err)
+			assert.Equal(t, "10", account.Wallet("EUR").Balance.String())
+			assert.Equal(t, "0", account.Wallet("EUR").Frozen.String())
+			require.NoError(t, accountRepo.Reconcile(ctx, 2))
+		})
+	}
+}
+
+func TestUnitOfWorkRollback(t *testing.T) {
+	transactionRepo := repo.NewTransactionPostgresRepo(db)
+	accountRepo := repo.NewAccountPostgresRepo(db)
+	uow := repo.NewUnitOfWork(db)
+
+	ctx := context.Background()
+	oldAccount, err := accountRepo.FindOne(ctx, 1)
+	require.NoError(t, err)
+
+	// the hold entry of an unexisting transaction fails, so the transaction row is rolled back too
+	var transaction model.Transaction
+	err = uow.Do(ctx, func(c context.Context) error {
+		var err error
+		if transaction, err = transactionRepo.InsertOne(c, model.TransactionRequest{AccountId: 1, Amount: money.New(10, 0), Currency: "RUB"}, model.Withdraw, model.FX{ConvertedAmount: money.New(10, 0)}); err != nil {
+			return err
+		}
+		_, err = accountRepo.Post(c, service.HoldEntry(model.Transaction{AccountId: 9999, Amount: money.New(10, 0), Currency: "RUB", Operation: model.Withdraw}))
+		return err
+	})
+	var pgErr *pgconn.PgError
+	require.ErrorAs(t, err, &pgErr)
+	assert.Equal(t, "23503", pgErr.Code)
+
+	_, err = transactionRepo.FindOne(ctx, transaction.Id)
+	require.ErrorIs(t, err, pgx.ErrNoRows)
+
+	gotAccount, err := accountRepo.FindOne(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, oldAccount.Wallets, gotAccount.Wallets)
+}
+
+func TestDeadLetterRepo(t *testing.T) {
+	transactionRepo := repo.NewTransactionPostgresRepo(db)
+	deadLetterRepo := repo.NewDeadLetterPostgresRepo(db)
+
+	ctx := context.Background()
+	transaction, err := transactionRepo.InsertOne(ctx, model.TransactionRequest{AccountId: 2, Amount: money.New(5, 0), Currency: "EUR"}, model.Invoice, model.FX{ConvertedAmount: money.New(5, 0)})
+	require.NoError(t, err)
+
+	createdId, err := deadLetterRepo.InsertOne(ctx, model.DeadLetter{TransactionId: transaction.Id, Reason: "processing failed", Attempts: 3})
+	require.NoError(t, err)
+	// transaction 1 is already settled with an error
+	settledId, err := deadLetterRepo.InsertOne(ctx, model.DeadLetter{TransactionId: 1, Reason: "malformed body"})
+	require.NoError(t, err)
+	_, err = deadLetterRepo.InsertOne(ctx, model.DeadLetter{TransactionId: 1 << 30, Reason: "unknown transaction"})
+	require.ErrorIs(t, err, errs.ErrUnknownTransaction)
+
+	deadLetters, err := deadLetterRepo.FindMany(ctx, false)
+	require.NoError(t, err)
+	require.Len(t, deadLetters, 2)
+	assert.Equal(t, transaction.Id, deadLetters[0].TransactionId)
+	assert.Equal(t, 3, deadLetters[0].Attempts)
+
+	var tests = []struct {
+		name          string
+		id            uint
+		expectedError error
+	}{
+		{"Created transaction should be redriven", createdId, nil},
+		{"Redriven dead letter should not be redriven twice", createdId, pgx.ErrNoRows},
+		{"Settled transaction should not be redriven", settledId, errs.ErrFinalStatus},
+		{"Unknown dead letter should not be redriven", 1 << 30, pgx.ErrNoRows},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deadLetter, err := deadLetterRepo.Redrive(ctx, tt.id)
+			if tt.expectedError != nil {
+				require.ErrorIs(t, err, tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.NotNil(t, deadLetter.RedrivenAt)
+		})
+	}
+
+	deadLetters, err = deadLetterRepo.FindMany(ctx, false)
+	require.NoError(t, err)
+	require.Len(t, deadLetters, 1)
+	assert.Equal(t, settledId, deadLetters[0].Id)
+
+	deadLetters, err = deadLetterRepo.FindMany(ctx, true)
+	require.NoError(t, err)
+	assert.Len(t, deadLetters, 2)
+}
+
+func TestEventRepoRelay(t *testing.T) {
+	eventRepo := repo.NewEventPostgresRepo(db)
+	ctx := context.Background()
+
+	var lastId uint
+	routingKeys := make(map[string]bool)
+	published, err := eventRepo.Relay(ctx, 1000, func(event model.Event) error {
+		// a batch is published by id
+		assert.Greater(t, event.Id, lastId)
+		lastId = event.Id
+		assert.Equal(t, model.EventVersion, event.Version)
+		routingKeys[event.RoutingKey] = true
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Positive(t, published)
+	assert.True(t, routingKeys["transaction.created.invoice.usd"])
+	assert.True(t, routingKeys["transaction.succeeded.invoice.eur"])
+	assert.True(t, routingKeys["transaction.succeeded.transfer.usd"])
+	assert.True(t, routingKeys["account.balance_changed.eur"])
+
+	published, err = eventRepo.Relay(ctx, 1000, func(event model.Event) error {
+		t.Fatalf("event %d is published twice", event.Id)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 0, published)
+}
+
+func TestWebhookRepo(t *testing.T) {
+	transactionRepo := repo.NewTransactionPostgresRepo(db)
+	webhookRepo := repo.NewWebhookPostgresRepo(db)
+	ctx := context.Background()
+
+	webhook, err := webhookRepo.InsertOne(ctx, 2, "http://localhost/hook", "secret")
+	require.NoError(t, err)
+	webhooks, err := webhookRepo.FindByAccount(ctx, 2)
+	require.NoError(t, err)
+	require.Len(t, webhooks, 1)
+	assert.Empty(t, webhooks[0].Secret)
+
+	// the final status queues a delivery of the account webhook
+	transaction, err := transactionRepo.InsertOne(ctx, model.TransactionRequest{AccountId: 2, Amount: money.New(1, 0), Currency: "EUR"}, model.Invoice, model.FX{ConvertedAmount: money.New(1, 0)})
+	require.NoError(t, err)
+	_, ok, err := transactionRepo.Finalize(ctx, transaction.Id, model.Error)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	attempted, err := webhookRepo.Deliver(ctx, 10, time.Minute, func(d model.WebhookDelivery) model.WebhookAttempt {
+		assert.Equal(t, webhook.Id, d.WebhookId)
+		assert.Equal(t, "secret", d.Secret)
+		assert.Contains(t, string(d.Payload), "transaction.failed")
+
+		// the claim is committed before the request, so the delivery is not attempted again while it is sent
+		again, err := webhookRepo.Deliver(ctx, 10, time.Minute, func(d model.WebhookDelivery) model.WebhookAttempt {
+			t.Fatalf("delivery %d is attempted twice", d.Id)
+			return model.WebhookAttempt{}
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 0, again)
+		return model.WebhookAttempt{Attempt: d.Attempts + 1, ResponseCode: 500, Error: "unexpected status 500"}
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, attempted)
+
+	failed, err := webhookRepo.FindDeliveries(ctx, 2, model.DeliveryFailed)
+	require.NoError(t, err)
+	require.Len(t, failed, 1)
+
+	// deliveries of another account are not redelivered
+	_, err = webhookRepo.Redeliver(ctx, 1, failed[0].Id)
+	require.ErrorIs(t, err, pgx.ErrNoRows)
+	_, err = webhookRepo.Redeliver(ctx, 2, failed[0].Id)
+	require.NoError(t, err)
+	attempted, err = webhookRepo.Deliver(ctx, 10, time.Minute, func(d model.WebhookDelivery) model.WebhookAttempt {
+		return model.WebhookAttempt{Attempt: d.Attempts + 1, ResponseCode: 200, Delivered: true}
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, attempted)
+
+	// deliveries of another account are not found
+	_, err = webhookRepo.FindDelivery(ctx, 1, failed[0].Id)
+	require.ErrorIs(t, err, pgx.ErrNoRows)
+	delivery, err := webhookRepo.FindDelivery(ctx, 2, failed[0].Id)
+	require.NoError(t, err)
+	assert.Equal(t, model.DeliveryDelivered, delivery.Status)
+	assert.Equal(t, 2, delivery.Attempts)
+	require.Len(t, delivery.Log, 2)
+	assert.False(t, delivery.Log[0].Delivered)
+	assert.True(t, delivery.Log[1].Delivered)
+
+	_, err = webhookRepo.Redeliver(ctx, 2, delivery.Id)
+	require.ErrorIs(t, err, pgx.ErrNoRows)
+}
+
+func TestRepoInvariants(t *testing.T) {
+	transactionRepo := repo.NewTransactionPostgresRepo(db)
+	accountRepo := repo.NewAccountPostgresRepo(db)
+	ctx := context.Background()
+
+	// the first transaction got the final Error status in TestTransactionRepoUpdateOne
+	err := transactionRepo.UpdateOne(ctx, 1, model.Created)
+	require.ErrorIs(t, err, errs.ErrFinalStatus)
+	err = transactionRepo.UpdateOne(ctx, 1, model.Success)
+	require.ErrorIs(t, err, errs.ErrFinalStatus)
+	require.NoError(t, transactionRepo.UpdateOne(ctx, 1, model.Error))
+	require.ErrorIs(t, transactionRepo.UpdateOne(ctx, 9999, model.Error), pgx.ErrNoRows)
+
+	transaction, err := transactionRepo.FindOne(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, model.Error, transaction.Status)
+
+	oldAccount, err := accountRepo.FindOne(ctx, 1)
+	require.NoError(t, err)
+	_, err = accountRepo.Post(ctx, model.JournalEntry{Kind: model.Adjust, Postings: []model.Posting{
+		{AccountId: 1, Bucket: model.Available, Currency: "RUB", Amount: oldAccount.Wallet("RUB").Balance.Add(money.New(1, 0)).Neg()},
+		{Bucket: model.Adjustment, Currency: "RUB", Amount: oldAccount.Wallet("RUB").Balance.Add(money.New(1, 0))},
+	}})
+	require.ErrorIs(t, err, errs.ErrNegativeBalance)
+
+	gotAccount, err := accountRepo.FindOne(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, oldAccount.Wallet("RUB").Balance.String(), gotAccount.Wallet("RUB").Balance.String())
+}
+
+func TestTransactionRepoInsertTransferConcurrent(t *testing.T) {
+	transactionRepo := repo.NewTransactionPostgresRepo(db)
+	accountRepo := repo.NewAccountPostgresRepo(db)
+	uow := repo.NewUnitOfWork(db)
+	ctx := context.Background()
+
+	_, err := transactionRepo.InsertTransfer(ctx, model.TransferRequest{FromAccountId: 1, ToAccountId: 2, Amount: money.New(1, 0), Currency: "USD"}, model.FX{ConvertedAmount: money.New(1, 0)})
+	require.ErrorIs(t, err, errs.ErrNoUnitOfWork)
+
+	// opposite transfers lock the wallets in the same order, so none of them fails with a deadlock
+	transfer := func(from, to uint) error {
+		return uow.Do(ctx, func(c context.Context) error {
+			in := model.TransferRequest{FromAccountId: from, ToAccountId: to, Amount: money.New(1, 0), Currency: "USD"}
+			transaction, err := transactionRepo.InsertTransfer(c, in, model.FX{ConvertedAmount: in.Amount})
+			if err != nil {
+				return err
+			}
+			_, err = accountRepo.Post(c, service.TransferEntry(transaction, transaction.Currency, transaction.Amount))
+			return err
+		})
+	}
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed []error
+	)
+	for i := 0; i < 10; i++ {
+		for _, pair := range [][2]uint{{1, 2}, {2, 1}} {
+			wg.Add(1)
+			go func(from, to uint) {
+				defer wg.Done()
+				if err := transfer(from, to); err != nil {
+					mu.Lock()
+					failed = append(failed, err)
+					mu.Unlock()
+				}
+			}(pair[0], pair[1])
+		}
+	}
+	wg.Wait()
+	assert.Empty(t, failed)
+
+	require.NoError(t, accountRepo.Reconcile(ctx, 1))
+	require.NoError(t, accountRepo.Reconcile(ctx, 2))
+}
+
+func TestEventRepoFindByAccount(t *testing.T) {
+	eventRepo := repo.NewEventPostgresRepo(db)
+	ctx := context.Background()
+
+	events, err := eventRepo.FindByAccount(ctx, 2, 0, 1000)
+	require.NoError(t, err)
+	require.Greater(t, len(events), 1)
+	transfer := false
+	for i, event := range events {
+		assert.Contains(t, event.AccountIds(), uint(2))
+		if i > 0 {
+			assert.Greater(t, event.Id, events[i-1].Id)
+		}
+		transfer = transfer || event.RoutingKey == "transaction.succeeded.transfer.usd"
+	}
+	// the receiver of a transfer gets its events too
+	assert.True(t, transfer)
+
+	after, err := eventRepo.FindByAccount(ctx, 2, events[0].Id, 1)
+	require.NoError(t, err)
+	require.Len(t, after, 1)
+	assert.Equal(t, events[1].Id, after[0].Id)
+}
@@ -0,0 +1,155 @@
+package service_test
+
+import (
+	"accountservice/internal/errs"
+	"accountservice/internal/model"
+	"accountservice/internal/money"
+	"accountservice/internal/service"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type failingProvider struct{}
+
+func (failingProvider) Name() string {
+	return "failing"
+}
+
+func (failingProvider) Rates(ctx context.Context) (map[string]model.Rate, error) {
+	return nil, errors.New("source is down")
+}
+
+func TestConvert(t *testing.T) {
+	provider, err := service.NewFixtureProvider("../../fixtures/rates.json")
+	require.NoError(t, err)
+
+	var tests = []struct {
+		name          string
+		from          string
+		to            string
+		amount        string
+		expected      string
+		expectedError error
+	}{
+		{"Same currency should not be converted", "USD", "USD", "10.5", "10.5", nil},
+		{"USD should be converted to RUB", "USD", "RUB", "10", "886.6", nil},
+		{"RUB should be converted to USD with rounding", "RUB", "USD", "1000", "11.28", nil},
+		{"Nominal should be taken into account", "JPY", "RUB", "1000", "610.44", nil},
+		{"Cross rate should be used between foreign currencies", "EUR", "USD", "100", "109.5", nil},
+		{"Unknown currency should fail", "RUB", "XXX", "1", "", errs.ErrUnsupportedCurrency},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := service.Convert(context.Background(), provider, tt.from, tt.to, money.MustParse(tt.amount))
+			if tt.expectedError != nil {
+				require.ErrorIs(t, err, tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, got.String())
+		})
+	}
+}
+
+func TestCompositeProvider(t *testing.T) {
+	fixture, err := service.NewFixtureProvider("../../fixtures/rates.json")
+	require.NoError(t, err)
+
+	provider := service.NewCompositeProvider(failingProvider{}, fixture)
+	rates, err := provider.Rates(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "88.6603", rates["USD"].Value.String())
+
+	_, err = service.NewCompositeProvider(failingProvider{}, failingProvider{}).Rates(context.Background())
+	require.Error(t, err)
+}
+
+func TestCBRProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/daily_json.js" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"Valute": {"USD": {"CharCode": "USD", "Nominal": 1, "Value": 89.6883}}}`))
+	}))
+	defer server.Close()
+
+	rates, err := service.NewCBRProvider(server.URL+"/daily_json.js", time.Second).Rates(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "89.6883", rates["USD"].Value.String())
+	assert.Equal(t, "1", rates["USD"].Nominal.String())
+
+	_, err = service.NewCBRProvider(server.URL+"/missing", time.Second).Rates(context.Background())
+	require.ErrorIs(t, err, errs.ErrCurrencyServiceUnavailable)
+}
+
+func TestExchange(t *testing.T) {
+	provider, err := service.NewFixtureProvider("../../fixtures/rates.json")
+	require.NoError(t, err)
+
+	var tests = []struct {
+		name           string
+		from           string
+		to             string
+		expectedRate   string
+		expectedSource string
+	}{
+		{"Same currency should have rate 1 without source", "USD", "USD", "1", ""},
+		{"Foreign currency rate should be taken as is", "USD", "RUB", "88.6603", "fixture"},
+		{"Base currency rate should be inverted", "RUB", "USD", "0.0112790054", "fixture"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			amount := money.MustParse("1234.56")
+			fx, err := service.Exchange(context.Background(), provider, tt.from, tt.to, amount)
+			require.NoError(t, err)
+			require.NotNil(t, fx.Rate)
+			assert.Equal(t, tt.expectedRate, fx.Rate.String())
+			assert.Equal(t, tt.expectedSource, fx.RateSource)
+			// the converted amount is reproducible from the recorded rate
+			assert.Equal(t, amount.Mul(*fx.Rate).RoundTo(tt.to).String(), fx.ConvertedAmount.String())
+		})
+	}
+}
+
+// memoryRateRepo keeps the stored rates.
+type memoryRateRepo struct {
+	stored []model.Rate
+}
+
+func (r *memoryRateRepo) InsertMany(c context.Context, rates []model.Rate) (int, error) {
+	r.stored = append(r.stored, rates...)
+	return len(rates), nil
+}
+
+func (r *memoryRateRepo) FindLatest(c context.Context) ([]model.Rate, error) {
+	return r.stored, nil
+}
+
+func (r *memoryRateRepo) FindHistory(c context.Context, currency string, from, to time.Time) ([]model.Rate, error) {
+	return nil, nil
+}
+
+func TestRateRefresherFixture(t *testing.T) {
+	fixture, err := service.NewFixtureProvider("../../fixtures/rates.json")
+	require.NoError(t, err)
+
+	// the fallback fixture of a failover chain is not stored as the current rates
+	rr := &memoryRateRepo{}
+	err = service.NewRateRefresher(service.NewCompositeProvider(failingProvider{}, fixture), rr, time.Hour).Refresh(context.Background())
+	require.ErrorIs(t, err, errs.ErrCurrencyServiceUnavailable)
+	assert.Empty(t, rr.stored)
+
+	// a fixture-only provider is meant for offline runs, so its rates are stored
+	require.NoError(t, service.NewRateRefresher(fixture, rr, time.Hour).Refresh(context.Background()))
+	assert.NotEmpty(t, rr.stored)
+}
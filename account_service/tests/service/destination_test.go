@@ -0,0 +1,69 @@
+package service_test
+
+import (
+	"accountservice/internal/model"
+	"accountservice/internal/service"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateDestination(t *testing.T) {
+	var tests = []struct {
+		name           string
+		input          model.Destination
+		expectedNumber string
+		expectedField  string
+	}{
+		{"Valid Visa card should pass", model.Destination{Type: model.Card, Number: "4111 1111 1111 1111"}, "4111111111111111", ""},
+		{"Valid Mir card should pass", model.Destination{Type: "CARD", Number: "2200-0000-0000-0004"}, "2200000000000004", ""},
+		{"Valid Amex card should pass", model.Destination{Type: model.Card, Number: "378282246310005"}, "378282246310005", ""},
+		{"Card with wrong checksum should fail", model.Destination{Type: model.Card, Number: "4111111111111112"}, "", "destination.number"},
+		{"Visa card with wrong length should fail", model.Destination{Type: model.Card, Number: "41111111111111"}, "", "destination.number"},
+		{"Card with unknown BIN should fail", model.Destination{Type: model.Card, Number: "9111111111111111"}, "", "destination.number"},
+		{"Card with letters should fail", model.Destination{Type: model.Card, Number: "4111abcd11111111"}, "", "destination.number"},
+		{"Valid TRON address should pass", model.Destination{Type: model.UsdtTrc20, Number: "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t"}, "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t", ""},
+		{"TRON address with wrong checksum should fail", model.Destination{Type: model.UsdtTrc20, Number: "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6u"}, "", "destination.number"},
+		{"TRON address with wrong prefix should fail", model.Destination{Type: model.UsdtTrc20, Number: "0x7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t"}, "", "destination.number"},
+		{"Valid checksummed Ethereum address should pass", model.Destination{Type: model.UsdtErc20, Number: "0xdAC17F958D2ee523a2206206994597C13D831ec7"}, "0xdAC17F958D2ee523a2206206994597C13D831ec7", ""},
+		{"Lowercase Ethereum address should pass", model.Destination{Type: model.UsdtErc20, Number: "0xdac17f958d2ee523a2206206994597c13d831ec7"}, "0xdac17f958d2ee523a2206206994597c13d831ec7", ""},
+		{"Ethereum address with wrong checksum should fail", model.Destination{Type: model.UsdtErc20, Number: "0xDac17F958D2ee523a2206206994597C13D831ec7"}, "", "destination.number"},
+		{"Short Ethereum address should fail", model.Destination{Type: model.UsdtErc20, Number: "0xdac17f958d2ee523a2206206994597c13d831e"}, "", "destination.number"},
+		{"Unknown type should fail", model.Destination{Type: "iban", Number: "DE89370400440532013000"}, "", "destination.type"},
+		{"Empty number should fail", model.Destination{Type: model.Card}, "", "destination.number"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, fieldErrs := service.ValidateDestination(tt.input)
+			if tt.expectedField != "" {
+				require.Len(t, fieldErrs, 1)
+				assert.Equal(t, tt.expectedField, fieldErrs[0].Field)
+				return
+			}
+			require.Empty(t, fieldErrs)
+			assert.Equal(t, tt.expectedNumber, got.Number)
+		})
+	}
+}
+
+func TestDestinationMasked(t *testing.T) {
+	var tests = []struct {
+		name           string
+		input          model.Destination
+		expectedNumber string
+	}{
+		{"Card number should keep the BIN and the last four digits", model.Destination{Type: model.Card, Number: "4111111111111111"}, "411111******1111"},
+		{"Masked card number should stay the same", model.Destination{Type: model.Card, Number: "411111******1111"}, "411111******1111"},
+		{"Wallet address should not be masked", model.Destination{Type: model.UsdtTrc20, Number: "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t"}, "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expectedNumber, tt.input.Masked().Number)
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package service_test
+
+import (
+	"accountservice/internal/errs"
+	"accountservice/internal/model"
+	"accountservice/internal/service"
+	"context"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryProcessor(t *testing.T) {
+	var tests = []struct {
+		name           string
+		outcome        string
+		expectedStatus model.Status
+		expectedError  error
+	}{
+		{"Success outcome should reply Success", service.OutcomeSuccess, model.Success, nil},
+		{"Error outcome should reply Error", service.OutcomeError, model.Error, nil},
+		{"Timeout outcome should not reply", service.OutcomeTimeout, model.Created, errs.ErrProcessingTimeout},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			processor, err := service.NewMemoryProcessor(tt.outcome, 10*time.Millisecond, 100*time.Millisecond)
+			require.NoError(t, err)
+
+			ctx := context.Background()
+			require.NoError(t, processor.Publish(ctx, model.Transaction{Id: 1}))
+			status, err := processor.Await(ctx, 1)
+			if tt.expectedError != nil {
+				require.ErrorIs(t, err, tt.expectedError)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, tt.expectedStatus, status)
+		})
+	}
+}
+
+func TestMemoryProcessorDeadLetter(t *testing.T) {
+	processor, err := service.NewMemoryProcessor(service.OutcomeDead, 0, 100*time.Millisecond)
+	require.NoError(t, err)
+
+	deadLetters := make(chan model.DeadLetter, 1)
+	require.NoError(t, processor.ConsumeDeadLetters(func(d model.DeadLetter) error {
+		deadLetters <- d
+		return nil
+	}))
+
+	require.NoError(t, processor.Publish(context.Background(), model.Transaction{Id: 7}))
+	select {
+	case d := <-deadLetters:
+		assert.Equal(t, uint(7), d.TransactionId)
+	case <-time.After(time.Second):
+		t.Fatal("transaction is not dead-lettered")
+	}
+
+	_, err = service.NewMemoryProcessor("unknown", 0, time.Second)
+	require.Error(t, err)
+}
+
+func TestMemoryProcessorDuplicatePublish(t *testing.T) {
+	processor, err := service.NewMemoryProcessor(service.OutcomeSuccess, 0, 100*time.Millisecond)
+	require.NoError(t, err)
+
+	before := runtime.NumGoroutine()
+	ctx := context.Background()
+	require.NoError(t, processor.Publish(ctx, model.Transaction{Id: 3}))
+	require.NoError(t, processor.Publish(ctx, model.Transaction{Id: 3}))
+
+	// the second reply is dropped instead of blocking the processing goroutine
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.LessOrEqual(t, runtime.NumGoroutine(), before)
+
+	status, err := processor.Await(ctx, 3)
+	require.NoError(t, err)
+	assert.Equal(t, model.Success, status)
+}
@@ -0,0 +1,75 @@
+package service_test
+
+import (
+	"accountservice/internal/service"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackoff(t *testing.T) {
+	var tests = []struct {
+		name     string
+		attempt  int
+		expected time.Duration
+	}{
+		{"First attempt should wait the base delay", 1, time.Second},
+		{"Delay should double", 2, 2 * time.Second},
+		{"Delay should double again", 3, 4 * time.Second},
+		{"Delay should be capped", 10, 30 * time.Second},
+		{"Huge attempt should not overflow", 1000, 30 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, service.Backoff(time.Second, 30*time.Second, tt.attempt))
+		})
+	}
+}
+
+func TestReconnector(t *testing.T) {
+	var (
+		attempts        atomic.Int32
+		degradedOnRetry atomic.Bool
+		resumed         atomic.Int32
+		reconnector     *service.Reconnector
+	)
+	connect := func() error {
+		degradedOnRetry.Store(reconnector.Degraded())
+		if attempts.Add(1) < 4 {
+			return errors.New("connection refused")
+		}
+		return nil
+	}
+	reconnector = service.NewReconnector(connect, func() { resumed.Add(1) }, time.Millisecond, 4*time.Millisecond)
+
+	assert.False(t, reconnector.Degraded())
+	assert.True(t, reconnector.Reconnect())
+	assert.Equal(t, int32(4), attempts.Load())
+	assert.True(t, degradedOnRetry.Load(), "connection should be degraded while reconnecting")
+	assert.False(t, reconnector.Degraded())
+	assert.Equal(t, int32(1), resumed.Load(), "requests should be resumed once")
+}
+
+func TestReconnectorClose(t *testing.T) {
+	var (
+		attempts    atomic.Int32
+		resumed     atomic.Int32
+		reconnector *service.Reconnector
+	)
+	connect := func() error {
+		if attempts.Add(1) == 2 {
+			reconnector.Close()
+		}
+		return errors.New("connection refused")
+	}
+	reconnector = service.NewReconnector(connect, func() { resumed.Add(1) }, time.Millisecond, time.Millisecond)
+
+	assert.False(t, reconnector.Reconnect())
+	assert.Equal(t, int32(2), attempts.Load(), "closed reconnector should stop retrying")
+	assert.Zero(t, resumed.Load())
+	assert.True(t, reconnector.Closed())
+}
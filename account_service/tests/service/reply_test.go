@@ -0,0 +1,115 @@
+package service_test
+
+import (
+	"accountservice/internal/errs"
+	"accountservice/internal/model"
+	"accountservice/internal/service"
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func reply(transactionId uint, status model.Status) amqp.Delivery {
+	return amqp.Delivery{CorrelationId: fmt.Sprint(transactionId), Body: []byte(fmt.Sprint(int(status)))}
+}
+
+func TestReplyRouterOutOfOrder(t *testing.T) {
+	replies := service.NewReplyRouter(time.Second)
+	msgs := make(chan amqp.Delivery)
+	defer close(msgs)
+	go replies.Dispatch(msgs)
+
+	expected := map[uint]model.Status{1: model.Success, 2: model.Error, 3: model.Success}
+	for id := range expected {
+		replies.Expect(model.Transaction{Id: id})
+	}
+
+	var (
+		wg  sync.WaitGroup
+		mu  sync.Mutex
+		got = make(map[uint]model.Status)
+	)
+	for id := range expected {
+		wg.Add(1)
+		go func(id uint) {
+			defer wg.Done()
+			status, err := replies.Await(context.Background(), id)
+			assert.NoError(t, err)
+			mu.Lock()
+			got[id] = status
+			mu.Unlock()
+		}(id)
+	}
+
+	// the replies come in another order than the requests
+	for _, id := range []uint{3, 1, 2} {
+		msgs <- reply(id, expected[id])
+	}
+	wg.Wait()
+	assert.Equal(t, expected, got)
+	assert.Empty(t, replies.Pending())
+}
+
+func TestReplyRouterReplyBeforeAwait(t *testing.T) {
+	replies := service.NewReplyRouter(time.Second)
+	msgs := make(chan amqp.Delivery)
+	defer close(msgs)
+	go replies.Dispatch(msgs)
+
+	replies.Expect(model.Transaction{Id: 1})
+	msgs <- reply(1, model.Success)
+	// a duplicated reply does not block the dispatcher
+	msgs <- reply(1, model.Success)
+
+	status, err := replies.Await(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, model.Success, status)
+}
+
+func TestReplyRouterTimeout(t *testing.T) {
+	replies := service.NewReplyRouter(20 * time.Millisecond)
+	msgs := make(chan amqp.Delivery)
+	defer close(msgs)
+	go replies.Dispatch(msgs)
+
+	// the router timeout applies without a deadline
+	replies.Expect(model.Transaction{Id: 1})
+	status, err := replies.Await(context.Background(), 1)
+	require.ErrorIs(t, err, errs.ErrProcessingTimeout)
+	assert.Equal(t, model.Created, status)
+
+	// the call deadline takes precedence
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = service.NewReplyRouter(time.Minute).Await(ctx, 2)
+	require.ErrorIs(t, err, errs.ErrProcessingTimeout)
+	assert.Less(t, time.Since(start), time.Second)
+
+	// a late reply is dropped and does not reach the next waiter
+	msgs <- reply(1, model.Success)
+	replies.Expect(model.Transaction{Id: 3})
+	msgs <- reply(3, model.Error)
+	status, err = replies.Await(context.Background(), 3)
+	require.NoError(t, err)
+	assert.Equal(t, model.Error, status)
+	assert.Empty(t, replies.Pending())
+}
+
+func TestReplyRouterPending(t *testing.T) {
+	replies := service.NewReplyRouter(time.Second)
+
+	replies.Expect(model.Transaction{Id: 1})
+	replies.Expect(model.Transaction{Id: 2})
+	replies.Forget(2)
+
+	pending := replies.Pending()
+	require.Len(t, pending, 1)
+	assert.Equal(t, uint(1), pending[0].Id)
+}
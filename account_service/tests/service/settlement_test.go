@@ -0,0 +1,59 @@
+package service_test
+
+import (
+	"accountservice/internal/model"
+	"accountservice/internal/service"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// replyProcessor replies with the same status to every transaction.
+type replyProcessor struct {
+	status model.Status
+}
+
+func (p replyProcessor) Publish(ctx context.Context, transaction model.Transaction) error {
+	return nil
+}
+
+func (p replyProcessor) Await(ctx context.Context, transactionId uint) (model.Status, error) {
+	return p.status, nil
+}
+
+func (p replyProcessor) Degraded() bool {
+	return false
+}
+
+// countingUnitOfWork counts the units of work without running them.
+type countingUnitOfWork struct {
+	calls *int
+}
+
+func (u countingUnitOfWork) Do(c context.Context, fn func(c context.Context) error) error {
+	*u.calls++
+	return nil
+}
+
+func TestSettlerAwait(t *testing.T) {
+	var tests = []struct {
+		name            string
+		status          model.Status
+		expectedSettled bool
+	}{
+		{"Success reply should be settled", model.Success, true},
+		{"Error reply should be settled", model.Error, true},
+		{"Created reply should be left for the recovery", model.Created, false},
+		{"Unknown reply should be left for the recovery", model.Status(7), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int
+			settler := service.NewSettler(replyProcessor{tt.status}, countingUnitOfWork{&calls}, nil, nil)
+			settler.Await(model.Transaction{Id: 1, AccountId: 1})
+			assert.Equal(t, tt.expectedSettled, calls == 1)
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package service_test
+
+import (
+	"accountservice/internal/model"
+	"accountservice/internal/service"
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// channelEventRepo passes the events sent to it to the listener.
+type channelEventRepo struct {
+	events chan model.Event
+}
+
+func (r channelEventRepo) Relay(c context.Context, limit int, publish func(model.Event) error) (int, error) {
+	return 0, nil
+}
+
+func (r channelEventRepo) FindByAccount(c context.Context, accountId, afterId uint, limit int) ([]model.Event, error) {
+	return nil, nil
+}
+
+func (r channelEventRepo) Listen(c context.Context, handle func(model.Event)) error {
+	for {
+		select {
+		case <-c.Done():
+			return c.Err()
+		case event := <-r.events:
+			handle(event)
+		}
+	}
+}
+
+func TestStreamHub(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	er := channelEventRepo{events: make(chan model.Event)}
+	hub := service.NewStreamHub(er)
+	stopped := make(chan struct{})
+	go func() {
+		hub.Run(ctx)
+		close(stopped)
+	}()
+
+	sender, unsubscribeSender := hub.Subscribe(1)
+	defer unsubscribeSender()
+	receiver, unsubscribeReceiver := hub.Subscribe(2)
+	other, unsubscribeOther := hub.Subscribe(3)
+	defer unsubscribeOther()
+
+	data, err := json.Marshal(map[string]uint{"accountId": 1, "counterpartyId": 2})
+	require.NoError(t, err)
+	er.events <- model.Event{Id: 1, Type: model.TransactionSucceeded, Data: data}
+
+	for _, events := range []<-chan model.Event{sender, receiver} {
+		select {
+		case event := <-events:
+			assert.Equal(t, uint(1), event.Id)
+		case <-time.After(time.Second):
+			t.Fatal("event was not delivered")
+		}
+	}
+	assert.Empty(t, other)
+
+	unsubscribeReceiver()
+	_, ok := <-receiver
+	assert.False(t, ok)
+
+	cancel()
+	<-stopped
+	_, ok = <-sender
+	assert.False(t, ok)
+}
+
+// sliceEventRepo stores the events in memory.
+type sliceEventRepo struct {
+	channelEventRepo
+	events []model.Event
+}
+
+func (r sliceEventRepo) FindByAccount(c context.Context, accountId, afterId uint, limit int) ([]model.Event, error) {
+	var events []model.Event
+	for _, event := range r.events {
+		if event.Id > afterId && slices.Contains(event.AccountIds(), accountId) && len(events) < limit {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func TestStreamHubReplay(t *testing.T) {
+	own, err := json.Marshal(map[string]uint{"accountId": 1})
+	require.NoError(t, err)
+	other, err := json.Marshal(map[string]uint{"accountId": 2})
+	require.NoError(t, err)
+
+	// more events than one replay batch
+	er := sliceEventRepo{}
+	for id := uint(1); id <= 250; id++ {
+		data := own
+		if id%2 == 0 {
+			data = other
+		}
+		er.events = append(er.events, model.Event{Id: id, Type: model.AccountBalanceChanged, Data: data})
+	}
+	hub := service.NewStreamHub(er)
+
+	var replayed []uint
+	err = hub.Replay(context.Background(), 1, 10, func(event model.Event) error {
+		replayed = append(replayed, event.Id)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, replayed, 120)
+	assert.Equal(t, uint(11), replayed[0])
+	assert.Equal(t, uint(249), replayed[len(replayed)-1])
+	assert.True(t, slices.IsSorted(replayed))
+
+	// the replay stops when the client is gone
+	stopped := errors.New("client is gone")
+	replayed = nil
+	err = hub.Replay(context.Background(), 1, 0, func(event model.Event) error {
+		replayed = append(replayed, event.Id)
+		return stopped
+	})
+	require.ErrorIs(t, err, stopped)
+	assert.Equal(t, []uint{1}, replayed)
+}
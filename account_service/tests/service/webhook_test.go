@@ -0,0 +1,128 @@
+package service_test
+
+import (
+	"accountservice/internal/errs"
+	"accountservice/internal/model"
+	"accountservice/internal/service"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignWebhook(t *testing.T) {
+	body := []byte(`{"type":"transaction.succeeded"}`)
+	timestamp := time.Unix(1705241757, 0)
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte("1705241757." + string(body)))
+	assert.Equal(t, "t=1705241757,v1="+hex.EncodeToString(mac.Sum(nil)), service.SignWebhook("secret", timestamp, body))
+	assert.NotEqual(t, service.SignWebhook("secret", timestamp, body), service.SignWebhook("other", timestamp, body))
+}
+
+func TestWebhookDispatcherDeliver(t *testing.T) {
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = append(received, string(body))
+
+		// the receiver checks the signature with the shared secret
+		signature := r.Header.Get(service.WebhookSignatureHeader)
+		timestamp := strings.TrimPrefix(strings.Split(signature, ",")[0], "t=")
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write([]byte(timestamp + "." + string(body)))
+		if !strings.HasSuffix(signature, ",v1="+hex.EncodeToString(mac.Sum(nil))) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "/hook", http.StatusFound)
+			return
+		}
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	// the test server listens on the loopback
+	dispatcher := service.NewWebhookDispatcher(nil, time.Second, time.Second, 10, 3, time.Minute, true)
+	delivery := model.WebhookDelivery{Id: 1, Url: server.URL + "/hook", Secret: "secret", Payload: []byte(`{"id":1}`)}
+
+	var tests = []struct {
+		name              string
+		url               string
+		secret            string
+		attempts          int
+		expectedDelivered bool
+		expectedCode      int
+		expectedRetry     bool
+	}{
+		{"Signed payload should be delivered", server.URL + "/hook", "secret", 0, true, http.StatusOK, false},
+		{"Wrong signature should be retried", server.URL + "/hook", "other", 0, false, http.StatusUnauthorized, true},
+		{"Failed delivery should be retried", server.URL + "/down", "secret", 1, false, http.StatusServiceUnavailable, true},
+		{"Last failed attempt should not be retried", server.URL + "/down", "secret", 2, false, http.StatusServiceUnavailable, false},
+		{"Redirect should not be followed", server.URL + "/redirect", "secret", 0, false, http.StatusFound, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delivery.Url, delivery.Secret, delivery.Attempts = tt.url, tt.secret, tt.attempts
+			attempt := dispatcher.Deliver(context.Background(), delivery)
+			assert.Equal(t, tt.attempts+1, attempt.Attempt)
+			assert.Equal(t, tt.expectedDelivered, attempt.Delivered)
+			assert.Equal(t, tt.expectedCode, attempt.ResponseCode)
+			assert.Equal(t, tt.expectedRetry, attempt.NextAttemptAt != nil)
+		})
+	}
+	assert.Equal(t, `{"id":1}`, received[0])
+	assert.Len(t, received, len(tests))
+
+	// private addresses are refused at dial time, whatever the registered host resolves to later
+	guarded := service.NewWebhookDispatcher(nil, time.Second, time.Second, 10, 3, time.Minute, false)
+	delivery.Url, delivery.Secret, delivery.Attempts = server.URL+"/hook", "secret", 0
+	attempt := guarded.Deliver(context.Background(), delivery)
+	assert.False(t, attempt.Delivered)
+	assert.Zero(t, attempt.ResponseCode)
+	assert.Contains(t, attempt.Error, errs.ErrPrivateAddress.Error())
+	assert.Len(t, received, len(tests))
+}
+
+func TestCheckWebhookHost(t *testing.T) {
+	var tests = []struct {
+		name          string
+		host          string
+		expectedError error
+	}{
+		{"Public address should be allowed", "93.184.216.34", nil},
+		{"Loopback should be refused", "127.0.0.1", errs.ErrPrivateAddress},
+		{"IPv6 loopback should be refused", "::1", errs.ErrPrivateAddress},
+		{"Private network should be refused", "10.0.0.1", errs.ErrPrivateAddress},
+		{"Link-local metadata address should be refused", "169.254.169.254", errs.ErrPrivateAddress},
+		{"IPv6 link-local should be refused", "fe80::1", errs.ErrPrivateAddress},
+		{"Unspecified address should be refused", "0.0.0.0", errs.ErrPrivateAddress},
+		{"IPv4-mapped loopback should be refused", "::ffff:127.0.0.1", errs.ErrPrivateAddress},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := service.CheckWebhookHost(context.Background(), tt.host)
+			if tt.expectedError != nil {
+				require.ErrorIs(t, err, tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"os"
 	"strconv"
 	"time"
 
@@ -19,8 +20,159 @@ const (
 	Create
 )
 
-func processTransaction(id uint) (Status, error) {
+const (
+	processQueue = "process_transaction"
+	// failed messages wait in a retry queue of the attempt delay and are dead-lettered back to processQueue
+	retryExchange = "process_transaction.retry"
+	// messages which failed maxAttempts times or cannot be parsed are parked in deadLetterQueue
+	deadLetterExchange = "process_transaction.dlx"
+	deadLetterQueue    = "process_transaction.dead"
+	// attemptHeader is the number of failed attempts, errorHeader is the last error
+	attemptHeader = "x-attempt"
+	errorHeader   = "x-error"
+)
+
+var (
+	maxAttempts    = envInt("MAX_ATTEMPTS", 3)
+	retryBaseDelay = envDuration("RETRY_BASE_DELAY", time.Second)
+	// transactions with ids divisible by failEvery fail their first failAttempts attempts, 0 disables failures
+	failEvery    = envInt("FAIL_EVERY", 0)
+	failAttempts = envInt("FAIL_ATTEMPTS", 1)
+)
+
+func envInt(key string, fallback int) int {
+	v, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return v
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	v, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return v
+}
+
+// retryDelay doubles the delay with every failed attempt.
+func retryDelay(attempt int) time.Duration {
+	return retryBaseDelay << (attempt - 1)
+}
+
+// declareTopology declares the retry queues, one per delay, and the dead letter queue.
+func declareTopology(ch *amqp.Channel) error {
+	if err := ch.ExchangeDeclare(retryExchange, "direct", true, false, false, false, nil); err != nil {
+		return err
+	}
+	for attempt := 1; attempt < maxAttempts; attempt++ {
+		delay := retryDelay(attempt)
+		q, err := ch.QueueDeclare(
+			fmt.Sprintf("%s.%s", retryExchange, delay), // name
+			true,  // durable
+			false, // delete when unused
+			false, // exclusive
+			false, // no-wait
+			amqp.Table{
+				"x-message-ttl":             delay.Milliseconds(),
+				"x-dead-letter-exchange":    "",
+				"x-dead-letter-routing-key": processQueue,
+			},
+		)
+		if err != nil {
+			return err
+		}
+		if err := ch.QueueBind(q.Name, delay.String(), retryExchange, false, nil); err != nil {
+			return err
+		}
+	}
+
+	if err := ch.ExchangeDeclare(deadLetterExchange, "fanout", true, false, false, false, nil); err != nil {
+		return err
+	}
+	if _, err := ch.QueueDeclare(deadLetterQueue, true, false, false, false, nil); err != nil {
+		return err
+	}
+	return ch.QueueBind(deadLetterQueue, "", deadLetterExchange, false, nil)
+}
+
+// attempts returns the number of the failed attempts of the message.
+func attempts(d amqp.Delivery) int {
+	switch v := d.Headers[attemptHeader].(type) {
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	}
+	return 0
+}
+
+// fail sends the message to the retry queue of the attempt or dead-letters it after maxAttempts.
+func fail(ctx context.Context, ch *amqp.Channel, d amqp.Delivery, retryable bool, cause error) error {
+	attempt := attempts(d) + 1
+
+	headers := amqp.Table{}
+	for k, v := range d.Headers {
+		headers[k] = v
+	}
+	headers[attemptHeader] = int32(attempt)
+	headers[errorHeader] = cause.Error()
+	msg := amqp.Publishing{
+		Headers:       headers,
+		ContentType:   d.ContentType,
+		CorrelationId: d.CorrelationId,
+		// the retried message keeps the idempotency key of the transaction
+		MessageId: d.MessageId,
+		ReplyTo:   d.ReplyTo,
+		Body:      d.Body,
+	}
+
+	if retryable && attempt < maxAttempts {
+		slog.Warn("retrying transaction", slog.Int("attempt", attempt), slog.Any("error", cause))
+		return ch.PublishWithContext(ctx, retryExchange, retryDelay(attempt).String(), true, false, msg)
+	}
+	slog.Error("dead-lettering transaction", slog.Int("attempt", attempt), slog.Any("error", cause))
+	return ch.PublishWithContext(ctx, deadLetterExchange, "", true, false, msg)
+}
+
+// processedLimit is the number of results remembered to answer the transactions published again.
+const processedLimit = 10000
+
+// processed keeps the latest results by message id, the account service publishes a transaction again
+// after reconnect or recovery and it must not be processed twice.
+type processed struct {
+	results map[string]Status
+	order   []string
+}
+
+func newProcessed() *processed {
+	return &processed{results: make(map[string]Status)}
+}
+
+func (p *processed) get(messageId string) (Status, bool) {
+	status, ok := p.results[messageId]
+	return status, ok
+}
+
+func (p *processed) put(messageId string, status Status) {
+	if _, ok := p.results[messageId]; ok {
+		return
+	}
+	if len(p.order) >= processedLimit {
+		delete(p.results, p.order[0])
+		p.order = p.order[1:]
+	}
+	p.results[messageId] = status
+	p.order = append(p.order, messageId)
+}
+
+// processTransaction processes the attempt, starting from 1, of the transaction.
+func processTransaction(id uint, attempt int) (Status, error) {
 	time.Sleep(10 * time.Second)
+	if failEvery > 0 && id%uint(failEvery) == 0 && attempt <= failAttempts {
+		return Error, fmt.Errorf("simulated failure of attempt %d", attempt)
+	}
 	if id%4 == 0 {
 		return Error, nil
 	}
@@ -57,13 +209,17 @@ func main() {
 	}
 	defer ch.Close()
 
+	if err := declareTopology(ch); err != nil {
+		panic(err)
+	}
+
 	q, err := ch.QueueDeclare(
-		"process_transaction", // name
-		false,                 // durable
-		false,                 // delete when unused
-		false,                 // exclusive
-		false,                 // no-wait
-		nil,                   // arguments
+		processQueue, // name
+		false,        // durable
+		false,        // delete when unused
+		false,        // exclusive
+		false,        // no-wait
+		nil,          // arguments
 	)
 	if err != nil {
 		panic(err)
@@ -93,14 +249,48 @@ func main() {
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 		defer cancel()
 
+		results := newProcessed()
 		for d := range msgs {
 			transactionId, err := strconv.Atoi(string(d.Body))
 			if err != nil {
-				panic(err)
+				// a malformed body fails on every attempt, so it is not retried
+				if err := fail(ctx, ch, d, false, fmt.Errorf("malformed body: %w", err)); err != nil {
+					// the message is not parked anywhere yet, so it is redelivered
+					slog.Error("failed to dead-letter transaction", slog.Any("error", err))
+					d.Nack(false, true)
+					continue
+				}
+				d.Ack(false)
+				continue
 			}
 
-			slog.Info("processing transaction", slog.Any("id", transactionId))
-			response, err := processTransaction(uint(transactionId))
+			messageId := d.MessageId
+			if messageId == "" {
+				messageId = string(d.Body)
+			}
+			response, duplicate := results.get(messageId)
+			if duplicate {
+				slog.Info("transaction is already processed", slog.Any("id", transactionId))
+			} else {
+				slog.Info("processing transaction",
+					slog.Any("id", transactionId),
+					slog.Any("destinationType", d.Headers["destination_type"]),
+				)
+				response, err = processTransaction(uint(transactionId), attempts(d)+1)
+				if err == nil {
+					// the reply is sent again for a duplicate, the transaction is not processed again
+					results.put(messageId, response)
+				}
+			}
+			if err != nil {
+				if err := fail(ctx, ch, d, true, err); err != nil {
+					slog.Error("failed to retry transaction", slog.Any("error", err))
+					d.Nack(false, true)
+					continue
+				}
+				d.Ack(false)
+				continue
+			}
 
 			err = ch.PublishWithContext(ctx,
 				"",        // exchange